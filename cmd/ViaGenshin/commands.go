@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+var exportCommandsCommand = &Command{
+	Flags: exportCommandsFlags,
+	Run:   runExportCommands,
+}
+
+var (
+	exportCommandsFlags   = flag.NewFlagSet("export-commands", flag.ExitOnError)
+	exportCommandsVersion = exportCommandsFlags.String("version", "", "protocol version to export, the base protocol if empty")
+	exportCommandsFormat  = exportCommandsFlags.String("format", string(config.CommandFormatCSV), "csv, idToName, nameToId or packetIds")
+	exportCommandsOutput  = exportCommandsFlags.String("o", "", "output file, the standard output if empty")
+)
+
+// runExportCommands writes the loaded command table of a protocol in any of
+// the supported formats.
+func runExportCommands() error {
+	m, err := mapper.NewMappingFromConfig(c.Protocols)
+	if err != nil {
+		return err
+	}
+	v := mapper.Protocol(*exportCommandsVersion)
+	if v == "" {
+		v = m.BaseProtocol
+	}
+	w := os.Stdout
+	if *exportCommandsOutput != "" {
+		f, err := os.Create(*exportCommandsOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *exportCommandsOutput, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	return m.WriteCommands(w, v, mapper.CommandFormat(*exportCommandsFormat))
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
@@ -16,10 +17,33 @@ import (
 
 var c *config.Config
 
-func init() {
+// Command runs instead of the service when named as the first argument,
+// followed by its flags and the optional config file.
+type Command struct {
+	Flags *flag.FlagSet
+	Run   func() error
+}
+
+var commands = map[string]*Command{
+	"export-commands": exportCommandsCommand,
+	"report":          reportCommand,
+}
+
+var command *Command
+
+// setup picks the command and loads the config, from the arguments or the
+// environment.
+func setup() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			_ = cmd.Flags.Parse(args[1:])
+			command, args = cmd, cmd.Flags.Args()
+		}
+	}
 	f := os.Getenv("VIA_GENSHIN_CONFIG_FILE")
-	if len(os.Args) > 1 {
-		f = os.Args[1]
+	if len(args) > 0 {
+		f = args[0]
 	}
 	if f == "" {
 		_, err := os.Stat("config.json")
@@ -51,6 +75,14 @@ func init() {
 }
 
 func main() {
+	setup()
+	if command != nil {
+		if err := command.Run(); err != nil {
+			logger.Error().Err(err).Msg("Command failed")
+			os.Exit(1)
+		}
+		return
+	}
 	s := core.NewService(c)
 
 	exited := make(chan error)
@@ -62,16 +94,38 @@ func main() {
 	// Wait for a signal to quit:
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	dump := make(chan os.Signal, 1)
+	if len(dumpSignals) > 0 {
+		signal.Notify(dump, dumpSignals...)
+	}
+	reload := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(reload, reloadSignals...)
+	}
 
-	select {
-	case err := <-exited:
-		if err != nil {
-			logger.Error().Err(err).Msg("Service exited")
-		}
-	case <-sig:
-		logger.Info().Msg("Signal received, stopping service")
-		if err := s.Stop(); err != nil {
-			logger.Error().Err(err).Msg("Service stop failed")
+	for {
+		select {
+		case err := <-exited:
+			if err != nil {
+				logger.Error().Err(err).Msg("Service exited")
+			}
+			return
+		case <-sig:
+			logger.Info().Msg("Signal received, stopping service")
+			if err := s.Stop(); err != nil {
+				logger.Error().Err(err).Msg("Service stop failed")
+			}
+			return
+		case <-dump:
+			if err := s.DumpLosses(); err != nil {
+				logger.Error().Err(err).Msg("Failed to dump losses")
+			}
+		case <-reload:
+			go func() {
+				if err := s.Reload(); err != nil {
+					logger.Error().Err(err).Msg("Failed to reload, keeping the current mappings or rewrites")
+				}
+			}()
 		}
 	}
 }
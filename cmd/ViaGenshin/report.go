@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+var reportCommand = &Command{
+	Flags: reportFlags,
+	Run:   runReport,
+}
+
+var (
+	reportFlags  = flag.NewFlagSet("report", flag.ExitOnError)
+	reportFormat = reportFlags.String("format", "text", "text or json")
+	reportOutput = reportFlags.String("o", "", "output file, the standard output if empty")
+	reportBase   = reportFlags.String("base", "", "base protocol of the -dir protocols, the lowest version if empty")
+	reportDirs   = protocolDirsFlag(reportFlags, "dir", "protocol directory as version=path, repeated, the protocols of the config if none")
+)
+
+// protocolDirs is a repeated version=path flag.
+type protocolDirs map[mapper.Protocol]string
+
+func protocolDirsFlag(f *flag.FlagSet, name, usage string) protocolDirs {
+	d := make(protocolDirs)
+	f.Var(d, name, usage)
+	return d
+}
+
+func (d protocolDirs) String() string {
+	var dirs []string
+	for v, dir := range d {
+		dirs = append(dirs, string(v)+"="+dir)
+	}
+	sort.Strings(dirs)
+	return strings.Join(dirs, ",")
+}
+
+func (d protocolDirs) Set(s string) error {
+	v, dir, ok := strings.Cut(s, "=")
+	if !ok || v == "" || dir == "" {
+		return fmt.Errorf("expected version=path, got %q", s)
+	}
+	d[mapper.Protocol(v)] = dir
+	return nil
+}
+
+type Report struct {
+	Protocols []*ProtocolReport `json:"protocols"`
+	Pairs     []*PairReport     `json:"pairs"`
+}
+
+type ProtocolReport struct {
+	Version          mapper.Protocol    `json:"version"`
+	Commands         int                `json:"commands"`
+	MissingArguments []*MissingArgument `json:"missingArguments,omitempty"`
+}
+
+// MissingArgument is an argument whose message is unknown or was not loaded.
+type MissingArgument struct {
+	Table   string `json:"table"`
+	ID      uint32 `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type PairReport struct {
+	From     mapper.Protocol `json:"from"`
+	To       mapper.Protocol `json:"to"`
+	Coverage *PairCoverage   `json:"coverage"`
+	OnlyFrom []*CommandEntry `json:"onlyFrom,omitempty"`
+	OnlyTo   []*CommandEntry `json:"onlyTo,omitempty"`
+	Messages []*MessageDiff  `json:"messages,omitempty"`
+}
+
+// PairCoverage is the percentage of the commands found on both sides, of the
+// common messages forwarded as is, and of the fields paired with the same
+// type.
+type PairCoverage struct {
+	Commands float64 `json:"commands"`
+	Messages float64 `json:"messages"`
+	Fields   float64 `json:"fields"`
+}
+
+type CommandEntry struct {
+	Name string `json:"name"`
+	ID   uint16 `json:"id"`
+}
+
+type MessageDiff struct {
+	Name    string       `json:"name"`
+	Added   []string     `json:"added,omitempty"`
+	Removed []string     `json:"removed,omitempty"`
+	Retyped []*FieldType `json:"retyped,omitempty"`
+}
+
+type FieldType struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// runReport compares every two protocols, to tell what a mapping will break
+// before clients are pointed at it.
+func runReport() error {
+	protocols := c.Protocols
+	if len(reportDirs) > 0 {
+		protocols = &config.ConfigProtocols{
+			BaseProtocol: mapper.Protocol(*reportBase),
+			Mapping:      reportDirs,
+		}
+		for v := range reportDirs {
+			if *reportBase == "" && (protocols.BaseProtocol == "" || config.CompareProtocols(v, protocols.BaseProtocol) < 0) {
+				protocols.BaseProtocol = v
+			}
+		}
+	}
+	if len(protocols.Mapping) < 2 {
+		return fmt.Errorf("at least two protocols are needed, got %d", len(protocols.Mapping))
+	}
+	m, err := mapper.NewMappingFromConfig(protocols)
+	if err != nil {
+		return err
+	}
+	r := newReport(m)
+	w := os.Stdout
+	if *reportOutput != "" {
+		f, err := os.Create(*reportOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *reportOutput, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *reportFormat {
+	case "text":
+		return r.WriteText(w)
+	case "json":
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(r)
+	}
+	return fmt.Errorf("unknown report format %s", *reportFormat)
+}
+
+func newReport(m *mapper.Mapping) *Report {
+	var versions []mapper.Protocol
+	for v := range m.MessageDescMap {
+		versions = append(versions, v)
+	}
+	config.SortProtocols(versions)
+	r := new(Report)
+	for _, v := range versions {
+		p := &ProtocolReport{Version: v, Commands: len(m.CommandIDMap[v])}
+		for _, t := range []struct {
+			name  string
+			table *mapper.ArgumentTable
+		}{{"ability", m.AbilityArgumentMap[v]}, {"combat", m.CombatArgumentMap[v]}} {
+			if t.table == nil {
+				continue
+			}
+			for _, a := range t.table.ByID {
+				if a.Message == "" || m.MessageDescMap[v][a.Message] == nil {
+					p.MissingArguments = append(p.MissingArguments, &MissingArgument{t.name, a.ID, a.Name, a.Message})
+				}
+			}
+		}
+		sort.Slice(p.MissingArguments, func(i, j int) bool {
+			a, b := p.MissingArguments[i], p.MissingArguments[j]
+			return a.Table < b.Table || a.Table == b.Table && a.ID < b.ID
+		})
+		r.Protocols = append(r.Protocols, p)
+	}
+	for i, from := range versions {
+		for _, to := range versions[i+1:] {
+			r.Pairs = append(r.Pairs, newPairReport(m, from, to))
+		}
+	}
+	return r
+}
+
+func newPairReport(m *mapper.Mapping, from, to mapper.Protocol) *PairReport {
+	p := &PairReport{From: from, To: to, Coverage: new(PairCoverage)}
+	fromCommands, toCommands := m.CommandIDMap[from], m.CommandIDMap[to]
+	var common int
+	for name, id := range fromCommands {
+		if _, ok := toCommands[name]; ok {
+			common++
+		} else {
+			p.OnlyFrom = append(p.OnlyFrom, &CommandEntry{name, id})
+		}
+	}
+	for name, id := range toCommands {
+		if _, ok := fromCommands[name]; !ok {
+			p.OnlyTo = append(p.OnlyTo, &CommandEntry{name, id})
+		}
+	}
+	sortCommands(p.OnlyFrom)
+	sortCommands(p.OnlyTo)
+	p.Coverage.Commands = percent(common, common+len(p.OnlyFrom)+len(p.OnlyTo))
+
+	var names []string
+	for name, fromDesc := range m.MessageDescMap[from] {
+		if fromDesc != nil && m.MessageDescMap[to][name] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	d := &messageDiffer{seen: make(map[string]bool)}
+	var equal int
+	for _, name := range names {
+		if m.SchemaEqual(from, to, name) {
+			equal++
+		}
+		d.message(m.MessageDescMap[from][name], m.MessageDescMap[to][name])
+	}
+	p.Messages = d.diffs
+	p.Coverage.Messages = percent(equal, len(names))
+	p.Coverage.Fields = percent(d.paired, d.fields)
+	return p
+}
+
+// messageDiffer compares the fields of two messages by name, and the
+// messages of the paired fields down the tree.
+type messageDiffer struct {
+	seen   map[string]bool
+	diffs  []*MessageDiff
+	fields int
+	paired int
+}
+
+func (d *messageDiffer) message(a, b *desc.MessageDescriptor) {
+	key := a.GetFullyQualifiedName() + " " + b.GetFullyQualifiedName()
+	if d.seen[key] {
+		return
+	}
+	d.seen[key] = true
+	diff := &MessageDiff{Name: a.GetFullyQualifiedName()}
+	for _, fa := range a.GetFields() {
+		d.fields++
+		fb := b.FindFieldByName(fa.GetName())
+		if fb == nil {
+			diff.Removed = append(diff.Removed, fa.GetName())
+			continue
+		}
+		if ta, tb := mapper.FieldTypeName(fa), mapper.FieldTypeName(fb); ta != tb {
+			diff.Retyped = append(diff.Retyped, &FieldType{fa.GetName(), ta, tb})
+		} else {
+			d.paired++
+		}
+	}
+	for _, fb := range b.GetFields() {
+		if a.FindFieldByName(fb.GetName()) == nil {
+			d.fields++
+			diff.Added = append(diff.Added, fb.GetName())
+		}
+	}
+	if len(diff.Added) > 0 || len(diff.Removed) > 0 || len(diff.Retyped) > 0 {
+		d.diffs = append(d.diffs, diff)
+	}
+	for _, fa := range a.GetFields() {
+		fb := b.FindFieldByName(fa.GetName())
+		if fb == nil {
+			continue
+		}
+		if fa.IsMap() && fb.IsMap() {
+			fa, fb = fa.GetMapValueType(), fb.GetMapValueType()
+		}
+		if ma, mb := fa.GetMessageType(), fb.GetMessageType(); ma != nil && mb != nil {
+			d.message(ma, mb)
+		}
+	}
+}
+
+func sortCommands(commands []*CommandEntry) {
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(n*10000/total) / 100
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	b := new(strings.Builder)
+	for _, p := range r.Protocols {
+		fmt.Fprintf(b, "%s: %d commands\n", p.Version, p.Commands)
+		for _, a := range p.MissingArguments {
+			message := a.Message
+			if message == "" {
+				message = "unknown message"
+			}
+			fmt.Fprintf(b, "  missing %s argument %d %s: %s\n", a.Table, a.ID, a.Name, message)
+		}
+	}
+	for _, p := range r.Pairs {
+		fmt.Fprintf(b, "\n%s <-> %s\n", p.From, p.To)
+		fmt.Fprintf(b, "  coverage: %.2f%% commands, %.2f%% messages, %.2f%% fields\n",
+			p.Coverage.Commands, p.Coverage.Messages, p.Coverage.Fields)
+		for _, c := range p.OnlyFrom {
+			fmt.Fprintf(b, "  only in %s: %s (%d)\n", p.From, c.Name, c.ID)
+		}
+		for _, c := range p.OnlyTo {
+			fmt.Fprintf(b, "  only in %s: %s (%d)\n", p.To, c.Name, c.ID)
+		}
+		for _, diff := range p.Messages {
+			var changes []string
+			for _, name := range diff.Added {
+				changes = append(changes, "+"+name)
+			}
+			for _, name := range diff.Removed {
+				changes = append(changes, "-"+name)
+			}
+			for _, f := range diff.Retyped {
+				changes = append(changes, fmt.Sprintf("~%s (%s -> %s)", f.Name, f.From, f.To))
+			}
+			fmt.Fprintf(b, "  %s: %s\n", diff.Name, strings.Join(changes, ", "))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
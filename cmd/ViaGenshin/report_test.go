@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	protocols := map[mapper.Protocol]map[string]string{
+		"v1.0.0": {
+			"protocol.csv":              "SameNotify,1\nPlayerReq,2\nOldReq,3\n",
+			"arguments.json":            `{"ability": [{"id": 5, "name": "ABILITY_INVOKE_ARGUMENT_GONE", "message": "AbilityGone"}, {"id": 6}], "combat": []}`,
+			"protocol/SameNotify.proto": `message SameNotify { uint32 a = 1; }`,
+			"protocol/PlayerReq.proto": `message PlayerReq { uint32 uid = 1; string name = 2; Info info = 3; map<uint32, Info> infos = 4; }
+message Info { uint32 level = 1; uint32 old = 2; }`,
+			"protocol/OldReq.proto": `message OldReq { uint32 a = 1; }`,
+		},
+		"v2.0.0": {
+			"protocol.csv":              "SameNotify,1\nPlayerReq,12\nNewReq,4\nOtherReq,5\n",
+			"arguments.json":            `{"ability": [], "combat": []}`,
+			"protocol/SameNotify.proto": `message SameNotify { uint32 a = 1; }`,
+			"protocol/PlayerReq.proto": `message PlayerReq { uint64 uid = 1; string name = 2; Info info = 3; map<uint32, Info> infos = 4; bool vip = 5; }
+message Info { uint32 level = 1; float exp = 3; }`,
+			"protocol/NewReq.proto":   `message NewReq { uint32 a = 1; }`,
+			"protocol/OtherReq.proto": `message OtherReq { uint32 a = 1; }`,
+		},
+	}
+	c := &config.ConfigProtocols{BaseProtocol: "v1.0.0", Mapping: make(map[mapper.Protocol]string)}
+	for v, files := range protocols {
+		root := filepath.Join(dir, string(v))
+		for name, content := range files {
+			if strings.HasSuffix(name, ".proto") {
+				content = "syntax = \"proto3\";\n" + content
+			}
+			file := filepath.Join(root, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c.Mapping[v] = root
+	}
+	m, err := mapper.NewMappingFromConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newReport(m)
+
+	if len(r.Protocols) != 2 || r.Protocols[0].Version != "v1.0.0" || r.Protocols[0].Commands != 3 || r.Protocols[1].Commands != 4 {
+		t.Fatalf("protocols %+v %+v, want v1.0.0 with 3 commands and v2.0.0 with 4", r.Protocols[0], r.Protocols[1])
+	}
+	missing := []*MissingArgument{
+		{"ability", 5, "ABILITY_INVOKE_ARGUMENT_GONE", "AbilityGone"},
+		{"ability", 6, "", ""},
+	}
+	if !reflect.DeepEqual(r.Protocols[0].MissingArguments, missing) {
+		t.Errorf("missing arguments %+v, want %+v", r.Protocols[0].MissingArguments, missing)
+	}
+	if len(r.Pairs) != 1 {
+		t.Fatalf("%d pairs, want 1", len(r.Pairs))
+	}
+	p := r.Pairs[0]
+	if p.From != "v1.0.0" || p.To != "v2.0.0" {
+		t.Errorf("pair %s <-> %s, want v1.0.0 <-> v2.0.0", p.From, p.To)
+	}
+	if want := []*CommandEntry{{"OldReq", 3}}; !reflect.DeepEqual(p.OnlyFrom, want) {
+		t.Errorf("only from %+v, want %+v", p.OnlyFrom, want)
+	}
+	if want := []*CommandEntry{{"NewReq", 4}, {"OtherReq", 5}}; !reflect.DeepEqual(p.OnlyTo, want) {
+		t.Errorf("only to %+v, want %+v", p.OnlyTo, want)
+	}
+	diffs := []*MessageDiff{
+		{Name: "PlayerReq", Added: []string{"vip"}, Retyped: []*FieldType{{"uid", "uint32", "uint64"}}},
+		{Name: "Info", Added: []string{"exp"}, Removed: []string{"old"}},
+	}
+	if !reflect.DeepEqual(p.Messages, diffs) {
+		for _, d := range p.Messages {
+			t.Logf("%+v", d)
+		}
+		t.Errorf("diffs differ")
+	}
+	// 2 of 5 commands, SameNotify of the 2 common messages, and of the 9
+	// fields a, name, info, infos and level.
+	if want := (&PairCoverage{Commands: 40, Messages: 50, Fields: 55.55}); *p.Coverage != *want {
+		t.Errorf("coverage %+v, want %+v", p.Coverage, want)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		n, total int
+		want     float64
+	}{
+		{0, 0, 100},
+		{0, 3, 0},
+		{1, 3, 33.33},
+		{2, 3, 66.66},
+		{3, 3, 100},
+	}
+	for _, tt := range tests {
+		if got := percent(tt.n, tt.total); got != tt.want {
+			t.Errorf("percent(%d, %d) = %v, want %v", tt.n, tt.total, got, tt.want)
+		}
+	}
+}
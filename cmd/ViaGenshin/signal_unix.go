@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// dumpSignals ask the service to dump the fields lost by the conversion.
+	dumpSignals = []os.Signal{syscall.SIGUSR1}
+	// reloadSignals ask the service to reload the protocol mappings.
+	reloadSignals = []os.Signal{syscall.SIGHUP}
+)
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+)
+
+// There is no user signal on Windows, the service is restarted to load new
+// protocols or rewrites, and dumps the losses when it stops.
+var (
+	dumpSignals   []os.Signal
+	reloadSignals []os.Signal
+)
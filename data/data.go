@@ -0,0 +1,10 @@
+// Package data holds the protocols embedded in the binary.
+package data
+
+import (
+	"io/fs"
+)
+
+// Protocols are the files of data/embed, embedded by a build with -tags embed,
+// nil otherwise.
+var Protocols fs.FS
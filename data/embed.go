@@ -0,0 +1,15 @@
+//go:build embed
+
+package data
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed embed
+var embedded embed.FS
+
+func init() {
+	Protocols, _ = fs.Sub(embedded, "embed")
+}
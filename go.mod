@@ -6,6 +6,7 @@ require (
 	github.com/golang/protobuf v1.5.3
 	github.com/jhump/protoreflect v1.15.1
 	github.com/rs/zerolog v1.29.0
+	google.golang.org/protobuf v1.30.0
 )
 
 require (
@@ -15,5 +16,4 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
 )
@@ -3,15 +3,28 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path"
+	"time"
 )
 
 type Config struct {
 	LogLevel  string           `json:"logLevel,omitempty"`
+	LossFile  string           `json:"lossFile,omitempty"`
+	Handlers  map[string]bool  `json:"handlers,omitempty"`
 	Endpoints *ConfigEndpoints `json:"endpoints,omitempty"`
 	Protocols *ConfigProtocols `json:"protocols,omitempty"`
 	Keys      *ConfigKeys      `json:"keys,omitempty"`
+
+	UnknownCommands *ConfigUnknownCommands `json:"unknownCommands,omitempty"`
+	Notifies        []*ConfigNotify        `json:"notifies,omitempty"`
+	Substitutions   []*ConfigSubstitution  `json:"substitutions,omitempty"`
+	Rewrites        []*ConfigRewrite       `json:"rewrites,omitempty"`
+	RewriteFile     string                 `json:"rewriteFile,omitempty"`
+
+	// file is the file the config was loaded from.
+	file string
 }
 
 type ConfigConsole struct {
@@ -29,8 +42,80 @@ type ConfigEndpoints struct {
 }
 
 type ConfigProtocols struct {
-	BaseProtocol Protocol            `json:"baseProtocol,omitempty"`
-	Mapping      map[Protocol]string `json:"mapping,omitempty"`
+	BaseProtocol Protocol                     `json:"baseProtocol,omitempty"`
+	Mapping      map[Protocol]string          `json:"mapping,omitempty"`
+	Commands     map[Protocol]*ConfigCommands `json:"commands,omitempty"`
+}
+
+// ConfigCommands locates the command table of a protocol, the file is
+// relative to the protocol directory.
+type ConfigCommands struct {
+	File   string        `json:"file,omitempty"`
+	Format CommandFormat `json:"format,omitempty"`
+}
+
+// ConfigUnknownCommands is what becomes of the commands with no pair in the
+// protocol they are converted to. The stub responses are read from the
+// protocol of the client, with the canned JSON of Responses by name and
+// Retcode, RET_FAIL if 0, unless the canned JSON sets it.
+type ConfigUnknownCommands struct {
+	Mode      UnknownCommandMode         `json:"mode,omitempty"`
+	Retcode   int32                      `json:"retcode,omitempty"`
+	Responses map[string]json.RawMessage `json:"responses,omitempty"`
+}
+
+type UnknownCommandMode string
+
+const (
+	UnknownCommandDrop        UnknownCommandMode = "drop"        // send nothing
+	UnknownCommandPassthrough UnknownCommandMode = "passthrough" // send the command as it is
+	UnknownCommandStub        UnknownCommandMode = "stub"        // answer the requests of the client
+)
+
+// ConfigNotify is a packet sent to the clients of Versions from nothing, Data
+// is its JSON in the client protocol. It is sent after every After packet of
+// the server, GetPlayerTokenRsp if empty, or only the first one if Once, or
+// every Every since GetPlayerTokenRsp.
+type ConfigNotify struct {
+	Name     string          `json:"name"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	After    string          `json:"after,omitempty"`
+	Once     bool            `json:"once,omitempty"`
+	Every    Duration        `json:"every,omitempty"`
+	Versions VersionRange    `json:"versions,omitempty"`
+}
+
+// ConfigSubstitution replaces the Request of the clients of Client with the
+// UpstreamRequest of the servers of Server, and turns the UpstreamResponse
+// answering it back into the Response. The fields of the same name are
+// copied, RequestFields and ResponseFields set the others from expressions
+// over the packet, the request of the client is request in ResponseFields.
+type ConfigSubstitution struct {
+	Name             string            `json:"name"`
+	Request          string            `json:"request"`
+	UpstreamRequest  string            `json:"upstreamRequest"`
+	UpstreamResponse string            `json:"upstreamResponse"`
+	Response         string            `json:"response"`
+	RequestFields    map[string]string `json:"requestFields,omitempty"`
+	ResponseFields   map[string]string `json:"responseFields,omitempty"`
+	Client           VersionRange      `json:"client,omitempty"`
+	Server           VersionRange      `json:"server,omitempty"`
+}
+
+// Duration is a time.Duration written as "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
 }
 
 type ConfigKeys struct {
@@ -50,6 +135,7 @@ func LoadConfig(path string) (*Config, error) {
 	if err := d.Decode(c); err != nil {
 		return nil, err
 	}
+	c.file = path
 	if c.Endpoints == nil {
 		return nil, errors.New("no endpoint configured")
 	}
@@ -62,6 +148,32 @@ func LoadConfig(path string) (*Config, error) {
 	if c.Keys == nil {
 		return nil, errors.New("no key configured")
 	}
+	if c.UnknownCommands == nil {
+		c.UnknownCommands = &ConfigUnknownCommands{}
+	}
+	switch c.UnknownCommands.Mode {
+	case "":
+		c.UnknownCommands.Mode = UnknownCommandDrop
+	case UnknownCommandDrop, UnknownCommandPassthrough, UnknownCommandStub:
+	default:
+		return nil, fmt.Errorf("unknown mode %q of unknown commands", c.UnknownCommands.Mode)
+	}
+	for i, n := range c.Notifies {
+		if n == nil || n.Name == "" {
+			return nil, fmt.Errorf("notify %d has no name", i)
+		}
+	}
+	for i, r := range c.Substitutions {
+		if r == nil || r.Name == "" {
+			return nil, fmt.Errorf("substitution %d has no name", i)
+		}
+		if r.Request == "" || r.UpstreamRequest == "" || r.UpstreamResponse == "" || r.Response == "" {
+			return nil, fmt.Errorf("substitution %s misses a request or a response", r.Name)
+		}
+	}
+	if err := validateRewrites(c.Rewrites); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
@@ -87,6 +199,9 @@ var DefaultConfig = &Config{
 		},
 	},
 	Keys: defaultConfigKeys,
+	UnknownCommands: &ConfigUnknownCommands{
+		Mode: UnknownCommandDrop,
+	},
 }
 
 var defaultConfigKeys = &ConfigKeys{
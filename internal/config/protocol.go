@@ -33,3 +33,13 @@ const (
 
 	ProtocolMajor4Minor0 Protocol = "v4.0.0"
 )
+
+type CommandFormat string
+
+const (
+	CommandFormatCSV       CommandFormat = "csv"       // name,id lines
+	CommandFormatIDToName  CommandFormat = "idToName"  // {"123": "PingReq"}
+	CommandFormatNameToID  CommandFormat = "nameToId"  // {"PingReq": 123}
+	CommandFormatPacketIDs CommandFormat = "packetIds" // Grasscutter packetIds.json
+	CommandFormatEnums     CommandFormat = "enums"     // enum CmdId in the proto files
+)
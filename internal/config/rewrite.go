@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ConfigRewrite rewrites the JSON of the Message packets going in Direction,
+// any if empty, from or to the clients of Versions. The JSON is that of the
+// protocol of the client, the packet is rewritten if it matches Match, with
+// the merge patch Merge then the JSON patch Patch.
+type ConfigRewrite struct {
+	Name      string           `json:"name,omitempty"`
+	Message   string           `json:"message"`
+	Direction RewriteDirection `json:"direction,omitempty"`
+	Versions  VersionRange     `json:"versions,omitempty"`
+	Match     json.RawMessage  `json:"match,omitempty"`
+	Merge     json.RawMessage  `json:"merge,omitempty"`
+	Patch     json.RawMessage  `json:"patch,omitempty"`
+}
+
+type RewriteDirection string
+
+const (
+	RewriteClientToServer RewriteDirection = "clientToServer"
+	RewriteServerToClient RewriteDirection = "serverToClient"
+)
+
+// LoadRewrites reads the rewrites of the config file and of its rewrite
+// file again, the rewrites loaded with the config if it was not read from a
+// file.
+func (c *Config) LoadRewrites() ([]*ConfigRewrite, error) {
+	rewrites, file := c.Rewrites, c.RewriteFile
+	if c.file != "" {
+		data, err := os.ReadFile(c.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rewrites: %w", err)
+		}
+		var current struct {
+			Rewrites    []*ConfigRewrite `json:"rewrites,omitempty"`
+			RewriteFile string           `json:"rewriteFile,omitempty"`
+		}
+		if err := json.Unmarshal(data, &current); err != nil {
+			return nil, fmt.Errorf("failed to parse rewrites of %s: %w", c.file, err)
+		}
+		rewrites, file = current.Rewrites, current.RewriteFile
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rewrites: %w", err)
+		}
+		var more []*ConfigRewrite
+		if err := json.Unmarshal(data, &more); err != nil {
+			return nil, fmt.Errorf("failed to parse rewrites of %s: %w", file, err)
+		}
+		rewrites = append(rewrites[:len(rewrites):len(rewrites)], more...)
+	}
+	if err := validateRewrites(rewrites); err != nil {
+		return nil, err
+	}
+	return rewrites, nil
+}
+
+func validateRewrites(rewrites []*ConfigRewrite) error {
+	for i, r := range rewrites {
+		if r == nil || r.Message == "" {
+			return fmt.Errorf("rewrite %d has no message", i)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("%s#%d", r.Message, i)
+		}
+		switch r.Direction {
+		case "", RewriteClientToServer, RewriteServerToClient:
+		default:
+			return fmt.Errorf("rewrite %s has an unknown direction %q", r.Name, r.Direction)
+		}
+		if len(r.Merge) == 0 && len(r.Patch) == 0 {
+			return fmt.Errorf("rewrite %s has no merge or patch", r.Name)
+		}
+	}
+	return nil
+}
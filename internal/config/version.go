@@ -0,0 +1,286 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed protocol version, v3.2.0, 3.2, 3.5.0-beta or
+// 3.5.0+os are all valid.
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string
+	Build               string
+	// parts is the count of numbers written, 3.3 in a range is 3.3.x.
+	parts int
+}
+
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	rest := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "v"), "V")
+	rest, v.Build, _ = strings.Cut(rest, "+")
+	rest, v.Pre, _ = strings.Cut(rest, "-")
+	numbers := strings.Split(rest, ".")
+	if len(numbers) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	for i, number := range numbers {
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		switch i {
+		case 0:
+			v.Major = n
+		case 1:
+			v.Minor = n
+		case 2:
+			v.Patch = n
+		}
+	}
+	v.parts = len(numbers)
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is older, the same as or newer than o. A
+// pre-release is older than the release, the build is ignored.
+func (v Version) Compare(o Version) int {
+	for _, d := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			return compareInts(d[0], d[1])
+		}
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// comparePre compares the pre-releases as semver does, by dot separated
+// identifiers, the numeric ones by value.
+func comparePre(a, b string) int {
+	if a == b {
+		return 0
+	} else if a == "" {
+		return 1
+	} else if b == "" {
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			return compareInts(an, bn)
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		}
+		return strings.Compare(as[i], bs[i])
+	}
+	return compareInts(len(as), len(bs))
+}
+
+// Version parses the protocol as a version.
+func (p Protocol) Version() (Version, error) {
+	return ParseVersion(string(p))
+}
+
+// CompareProtocols orders the protocols by version, the protocols that are
+// not versions come last, by name.
+func CompareProtocols(a, b Protocol) int {
+	av, aErr := a.Version()
+	bv, bErr := b.Version()
+	switch {
+	case aErr == nil && bErr == nil:
+		if c := av.Compare(bv); c != 0 {
+			return c
+		}
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(string(a), string(b))
+}
+
+func SortProtocols(protocols []Protocol) {
+	sort.Slice(protocols, func(i, j int) bool { return CompareProtocols(protocols[i], protocols[j]) < 0 })
+}
+
+// VersionRange is a set of versions, written as comparisons joined by
+// spaces, commas or "and", and alternatives joined by "||" or "or", e.g.
+// ">= 3.3 < 3.4" or "3.2 || >= 4.0". A version written without its patch is
+// every version starting with it, pre-releases included, so "3.3" is 3.3.x
+// and "< 3.4" excludes 3.4.0-beta. The empty range holds every version.
+type VersionRange struct {
+	text         string
+	alternatives [][]versionBound
+}
+
+type versionBound struct {
+	op string
+	v  Version
+}
+
+func ParseVersionRange(s string) (VersionRange, error) {
+	r := VersionRange{text: strings.TrimSpace(s)}
+	if r.text == "" {
+		return r, nil
+	}
+	for _, alternative := range splitWords(r.text, "||", "or") {
+		var all []versionBound
+		fields := strings.Fields(strings.ReplaceAll(alternative, ",", " "))
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			if field == "and" || field == "&&" {
+				continue
+			}
+			op := field[:len(field)-len(strings.TrimLeft(field, "<>=!"))]
+			text := field[len(op):]
+			if text == "" && i+1 < len(fields) {
+				i++
+				text = fields[i]
+			}
+			v, err := ParseVersion(text)
+			if err != nil {
+				return VersionRange{}, fmt.Errorf("invalid version range %q: %w", s, err)
+			}
+			switch op {
+			case "", "==":
+				op = "="
+			case "=", ">", ">=", "<", "<=", "!=":
+			default:
+				return VersionRange{}, fmt.Errorf("invalid version range %q: unknown operator %s", s, op)
+			}
+			all = append(all, versionBound{op, v})
+		}
+		if len(all) == 0 {
+			return VersionRange{}, fmt.Errorf("invalid version range %q", s)
+		}
+		r.alternatives = append(r.alternatives, all)
+	}
+	return r, nil
+}
+
+func splitWords(s string, words ...string) []string {
+	for _, word := range words[1:] {
+		s = strings.ReplaceAll(s, " "+word+" ", " "+words[0]+" ")
+	}
+	return strings.Split(s, words[0])
+}
+
+// Contains tells if the version is in the range.
+func (r VersionRange) Contains(v Version) bool {
+	if len(r.alternatives) == 0 {
+		return true
+	}
+	for _, all := range r.alternatives {
+		ok := true
+		for _, b := range all {
+			if !b.contains(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (b versionBound) contains(v Version) bool {
+	if b.v.parts == 3 || b.v.Pre != "" {
+		c := v.Compare(b.v)
+		switch b.op {
+		case "=":
+			return c == 0
+		case "!=":
+			return c != 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		}
+		return false
+	}
+	// A partial version is the versions from its first pre-release to the
+	// first pre-release of the next one.
+	lo := Version{Major: b.v.Major, Minor: b.v.Minor, Pre: "0"}
+	hi := Version{Major: b.v.Major + 1, Pre: "0"}
+	if b.v.parts == 2 {
+		hi = Version{Major: b.v.Major, Minor: b.v.Minor + 1, Pre: "0"}
+	}
+	in := v.Compare(lo) >= 0 && v.Compare(hi) < 0
+	switch b.op {
+	case "=":
+		return in
+	case "!=":
+		return !in
+	case ">":
+		return v.Compare(hi) >= 0
+	case ">=":
+		return v.Compare(lo) >= 0
+	case "<":
+		return v.Compare(lo) < 0
+	case "<=":
+		return v.Compare(hi) < 0
+	}
+	return false
+}
+
+// ContainsProtocol tells if the protocol is in the range, a protocol that is
+// not a version is only in the empty range.
+func (r VersionRange) ContainsProtocol(p Protocol) bool {
+	if len(r.alternatives) == 0 {
+		return true
+	}
+	v, err := p.Version()
+	return err == nil && r.Contains(v)
+}
+
+func (r VersionRange) String() string {
+	return r.text
+}
+
+func (r VersionRange) MarshalText() ([]byte, error) {
+	return []byte(r.text), nil
+}
+
+func (r *VersionRange) UnmarshalText(text []byte) error {
+	parsed, err := ParseVersionRange(string(text))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
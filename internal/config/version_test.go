@@ -0,0 +1,145 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"v3.2.0", "v3.2.0", false},
+		{"3.2", "v3.2.0", false},
+		{" V4 ", "v4.0.0", false},
+		{"3.5.0-beta.2", "v3.5.0-beta.2", false},
+		{"3.5.0-beta+os", "v3.5.0-beta+os", false},
+		{"3.5.0+os", "v3.5.0+os", false},
+		{"3.2.0.1", "", true},
+		{"3.x", "", true},
+		{"3.-1", "", true},
+		{"", "", true},
+		{"gio", "", true},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseVersion(%q) error = %v, want error %t", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && v.String() != tt.want {
+			t.Errorf("ParseVersion(%q) = %s, want %s", tt.in, v, tt.want)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// Each version is older than the next one.
+	ordered := []string{
+		"3.2.0-0",
+		"3.2.0-1",
+		"3.2.0-2",
+		"3.2.0-10",
+		"3.2.0-alpha",
+		"3.2.0-alpha.1",
+		"3.2.0-alpha.beta",
+		"3.2.0-beta",
+		"3.2.0",
+		"3.2.1",
+		"3.10.0-0",
+		"3.10.0",
+		"4.0.0",
+	}
+	for i, a := range ordered {
+		va, err := ParseVersion(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, b := range ordered {
+			vb, err := ParseVersion(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := va.Compare(vb), compareInts(i, j); got != want {
+				t.Errorf("%s compared to %s = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+	a, _ := ParseVersion("3.2.0+os")
+	b, _ := ParseVersion("3.2.0+cn")
+	if a.Compare(b) != 0 {
+		t.Error("the build is not ignored")
+	}
+}
+
+func TestVersionRange(t *testing.T) {
+	tests := []struct {
+		r    string
+		in   []string
+		out  []string
+		err  bool
+		text string
+	}{
+		{r: "", in: []string{"1.0.0", "3.2.0-beta"}},
+		{r: "3.2", in: []string{"3.2.0", "3.2.5", "3.2.0-beta", "3.2.0-0"}, out: []string{"3.1.9", "3.3.0-0", "3.3.0"}},
+		{r: "3", in: []string{"3.0.0-0", "3.9.9"}, out: []string{"2.9.9", "4.0.0-beta"}},
+		{r: "3.2.0", in: []string{"3.2.0", "3.2.0+os"}, out: []string{"3.2.0-beta", "3.2.1"}},
+		{r: "< 3.4", in: []string{"3.3.9"}, out: []string{"3.4.0-beta", "3.4.0"}},
+		{r: "<= 3.4", in: []string{"3.4.9", "3.4.0-beta"}, out: []string{"3.5.0-0"}},
+		{r: "> 3.4", in: []string{"3.5.0-beta", "4.0.0"}, out: []string{"3.4.9"}},
+		{r: ">= 3.4", in: []string{"3.4.0-beta", "3.4.0"}, out: []string{"3.3.9"}},
+		{r: "!= 3.4", in: []string{"3.3.0", "3.5.0"}, out: []string{"3.4.1"}},
+		{r: ">= 3.3 < 3.4", in: []string{"3.3.0", "3.3.5"}, out: []string{"3.2.0", "3.4.0"}},
+		{r: ">=3.3, <3.4", in: []string{"3.3.5"}, out: []string{"3.4.0"}},
+		{r: ">= 3.3 and < 3.4", in: []string{"3.3.5"}, out: []string{"3.4.0"}},
+		{r: ">= 3.5.0-beta.2", in: []string{"3.5.0-beta.2", "3.5.0-beta.10", "3.5.0"}, out: []string{"3.5.0-beta.1", "3.5.0-alpha"}},
+		{r: "3.2 || >= 4.0", in: []string{"3.2.1", "4.1.0"}, out: []string{"3.3.0", "3.9.0"}},
+		{r: "3.2 or 3.4", in: []string{"3.2.0", "3.4.0"}, out: []string{"3.3.0"}},
+		{r: "=3.2||=3.4", in: []string{"3.2.0", "3.4.0"}, out: []string{"3.3.0"}},
+		{r: "~ 3.2", err: true},
+		{r: ">= x", err: true},
+		{r: "3.2 ||", err: true},
+	}
+	for _, tt := range tests {
+		r, err := ParseVersionRange(tt.r)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseVersionRange(%q) error = %v, want error %t", tt.r, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for _, s := range tt.in {
+			if v, _ := ParseVersion(s); !r.Contains(v) {
+				t.Errorf("%q does not contain %s", tt.r, s)
+			}
+		}
+		for _, s := range tt.out {
+			if v, _ := ParseVersion(s); r.Contains(v) {
+				t.Errorf("%q contains %s", tt.r, s)
+			}
+		}
+	}
+}
+
+func TestVersionRangeProtocols(t *testing.T) {
+	r, err := ParseVersionRange(">= 3.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.ContainsProtocol("v3.2.0") || r.ContainsProtocol("v3.1.0") || r.ContainsProtocol("custom") {
+		t.Errorf("%q contains the wrong protocols", r)
+	}
+	if !(VersionRange{}).ContainsProtocol("custom") {
+		t.Error("the empty range does not contain every protocol")
+	}
+	protocols := []Protocol{"custom", "v3.10.0", "v3.2.0", "v3.2.0-beta", "beta"}
+	SortProtocols(protocols)
+	want := []Protocol{"v3.2.0-beta", "v3.2.0", "v3.10.0", "beta", "custom"}
+	for i := range want {
+		if protocols[i] != want[i] {
+			t.Fatalf("sorted %v, want %v", protocols, want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// expression is a field expression of a substitution: field paths, numbers,
+// strings and booleans joined by + - * / % and parentheses. The arithmetic
+// is integral unless one of the operands is not.
+type expression struct {
+	text string
+	eval func(scope *exprScope) (any, error)
+}
+
+// exprScope holds the objects the paths of an expression are read from, a
+// path starting with request is read from the request if there is one.
+type exprScope struct {
+	packet      map[string]any
+	packetDesc  *desc.MessageDescriptor
+	request     map[string]any
+	requestDesc *desc.MessageDescriptor
+}
+
+func (e *expression) Eval(scope *exprScope) (any, error) {
+	v, err := e.eval(scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %w", e.text, err)
+	}
+	return v, nil
+}
+
+func compileExpression(text string) (*expression, error) {
+	p := &exprParser{text: text}
+	if err := p.tokenize(); err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", text, err)
+	}
+	eval, err := p.sum()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", text, err)
+	}
+	return &expression{text: text, eval: eval}, nil
+}
+
+type exprTokenKind uint8
+
+const (
+	exprNumber exprTokenKind = iota
+	exprString
+	exprPath
+	exprOperator
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+}
+
+type exprParser struct {
+	text   string
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) tokenize() error {
+	s := p.text
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("+-*/%()", c):
+			p.tokens = append(p.tokens, exprToken{exprOperator, s[i : i+1]})
+			i++
+		case c == '"' || c == '\'':
+			j := strings.IndexRune(s[i+1:], c)
+			if j < 0 {
+				return errors.New("unterminated string")
+			}
+			p.tokens = append(p.tokens, exprToken{exprString, s[i+1 : i+1+j]})
+			i += j + 2
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{exprNumber, s[i:j]})
+			i = j
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{exprPath, s[i:j]})
+			i = j
+		default:
+			return fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) operator(ops string) (string, bool) {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == exprOperator && strings.Contains(ops, p.tokens[p.pos].text) {
+		p.pos++
+		return p.tokens[p.pos-1].text, true
+	}
+	return "", false
+}
+
+type exprFunc = func(scope *exprScope) (any, error)
+
+func (p *exprParser) sum() (exprFunc, error) {
+	return p.binary("+-", p.product)
+}
+
+func (p *exprParser) product() (exprFunc, error) {
+	return p.binary("*/%", p.unary)
+}
+
+func (p *exprParser) binary(ops string, next func() (exprFunc, error)) (exprFunc, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.operator(ops)
+		if !ok {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(scope *exprScope) (any, error) {
+			a, err := l(scope)
+			if err != nil {
+				return nil, err
+			}
+			b, err := right(scope)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic(op, a, b)
+		}
+	}
+}
+
+func (p *exprParser) unary() (exprFunc, error) {
+	if _, ok := p.operator("-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(scope *exprScope) (any, error) {
+			v, err := operand(scope)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic("-", int64(0), v)
+		}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprFunc, error) {
+	if _, ok := p.operator("("); ok {
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.operator(")"); !ok {
+			return nil, errors.New("missing )")
+		}
+		return inner, nil
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case exprNumber:
+		v, ok := parseNumber(t.text)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %s", t.text)
+		}
+		return func(*exprScope) (any, error) { return v, nil }, nil
+	case exprString:
+		return func(*exprScope) (any, error) { return t.text, nil }, nil
+	case exprPath:
+		switch t.text {
+		case "true", "false":
+			v := t.text == "true"
+			return func(*exprScope) (any, error) { return v, nil }, nil
+		}
+		path := strings.Split(t.text, ".")
+		return func(scope *exprScope) (any, error) { return scope.lookup(path), nil }, nil
+	}
+	return nil, fmt.Errorf("unexpected %s", t.text)
+}
+
+// lookup returns the value at the path, nil if it is not set.
+func (s *exprScope) lookup(path []string) any {
+	obj, md := s.packet, s.packetDesc
+	if path[0] == "request" && s.request != nil {
+		obj, md, path = s.request, s.requestDesc, path[1:]
+	}
+	var v any = obj
+	for _, name := range path {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		key := name
+		if fd := findJSONField(md, name); fd != nil {
+			key, md = fd.GetJSONName(), fd.GetMessageType()
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+// findJSONField looks up a field of the message by its proto or JSON name.
+func findJSONField(md *desc.MessageDescriptor, name string) *desc.FieldDescriptor {
+	if md == nil {
+		return nil
+	}
+	if fd := md.FindFieldByName(name); fd != nil {
+		return fd
+	}
+	return md.FindFieldByJSONName(name)
+}
+
+func parseNumber(s string) (any, bool) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// number returns the value as an int64 if it is integral, a float64
+// otherwise. An unset value is 0, the int64 and uint64 fields are strings
+// in JSON.
+func number(v any) (any, bool) {
+	switch v := v.(type) {
+	case nil:
+		return int64(0), true
+	case int64, float64:
+		return v, true
+	case json.Number:
+		return parseNumber(string(v))
+	case string:
+		return parseNumber(v)
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	}
+	return nil, false
+}
+
+func arithmetic(op string, a, b any) (any, error) {
+	x, ok := number(a)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", a)
+	}
+	y, ok := number(b)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", b)
+	}
+	if i, ok := x.(int64); ok {
+		if j, ok := y.(int64); ok {
+			switch op {
+			case "+":
+				return i + j, nil
+			case "-":
+				return i - j, nil
+			case "*":
+				return i * j, nil
+			}
+			if j == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if op == "/" {
+				return i / j, nil
+			}
+			return i % j, nil
+		}
+	}
+	f, g := toFloat(x), toFloat(y)
+	switch op {
+	case "+":
+		return f + g, nil
+	case "-":
+		return f - g, nil
+	case "*":
+		return f * g, nil
+	case "/":
+		return f / g, nil
+	}
+	return math.Mod(f, g), nil
+}
+
+func toFloat(v any) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
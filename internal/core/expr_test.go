@@ -0,0 +1,106 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+func TestExpression(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {
+			"TimeReq": `message TimeReq { uint32 game_time = 1; uint64 client_time = 2; Inner inner = 3; }
+message Inner { float scale = 1; }`,
+			"TimeRsp": `message TimeRsp { uint32 game_time = 1; }`,
+		},
+	}, map[mapper.Protocol]string{"v1.0.0": "TimeReq,1\nTimeRsp,2\n"})
+	md := m.MessageDescMap["v1.0.0"]
+	packet, err := decodeObject([]byte(`{"gameTime": 1500}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := decodeObject([]byte(`{"gameTime": 90, "clientTime": "3000", "inner": {"scale": 0.5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := &exprScope{packet: packet, packetDesc: md["TimeRsp"], request: request, requestDesc: md["TimeReq"]}
+	tests := []struct {
+		text string
+		want any
+	}{
+		{"1 + 2 * 3", int64(7)},
+		{"(1 + 2) * 3", int64(9)},
+		{"10 - 4 - 3", int64(3)},
+		{"7 / 2", int64(3)},
+		{"7 % 4 * 2", int64(6)},
+		{"-3 + 5", int64(2)},
+		{"-(3 + 5)", int64(-8)},
+		{"2 * -3", int64(-6)},
+		{"--3", int64(3)},
+		{"7 / 2.0", 3.5},
+		{"1.5 + 1", 2.5},
+		{"7.5 % 2", 1.5},
+		{"'text'", "text"},
+		{"true", true},
+		{"true + 1", int64(2)},
+		{"gameTime % 1440", int64(60)},
+		{"game_time - 1440", int64(60)},
+		{"missing + 1", int64(1)},
+		{"request.gameTime", json.Number("90")},
+		{"request.game_time * 2", int64(180)},
+		// The int64 and uint64 fields are strings in JSON.
+		{"request.clientTime - 1", int64(2999)},
+		{"request.inner.scale * 4", 2.0},
+		{"request.missing", nil},
+	}
+	for _, tt := range tests {
+		e, err := compileExpression(tt.text)
+		if err != nil {
+			t.Errorf("compileExpression(%q): %v", tt.text, err)
+			continue
+		}
+		got, err := e.Eval(scope)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.text, err)
+		} else if got != tt.want {
+			t.Errorf("Eval(%q) = %#v, want %#v", tt.text, got, tt.want)
+		}
+	}
+
+	// Without a request, request is a field of the packet.
+	e, err := compileExpression("request.gameTime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := e.Eval(&exprScope{packet: packet, packetDesc: md["TimeRsp"]}); got != nil || err != nil {
+		t.Errorf("Eval without a request = %v, %v, want nil", got, err)
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, text := range []string{"", "1 +", "(1 + 2", "1 2", "'open", "1 # 2", "1..2"} {
+		if _, err := compileExpression(text); err == nil {
+			t.Errorf("compileExpression(%q) succeeded, want an error", text)
+		}
+	}
+	for _, text := range []string{"1 / 0", "5 % (2 - 2)", "'a' + 1", "1 - 'b'"} {
+		e, err := compileExpression(text)
+		if err != nil {
+			t.Errorf("compileExpression(%q): %v", text, err)
+			continue
+		}
+		if _, err := e.Eval(&exprScope{}); err == nil || !strings.Contains(err.Error(), text) {
+			t.Errorf("Eval(%q) = %v, want an error naming the expression", text, err)
+		}
+	}
+	// Float division by zero follows IEEE 754.
+	e, err := compileExpression("1.0 / 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Eval(&exprScope{}); err != nil {
+		t.Errorf("Eval(1.0 / 0): %v", err)
+	}
+}
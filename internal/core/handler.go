@@ -1,72 +1,186 @@
 package core
 
 import (
-	"encoding/json"
+	"fmt"
+	"sort"
 
+	"github.com/Jx2f/ViaGenshin/internal/config"
 	"github.com/Jx2f/ViaGenshin/internal/mapper"
 )
 
-func (s *Session) HandlePacket(from, to mapper.Protocol, name string, head, data []byte) ([]byte, error) {
-	switch name {
-	case "GetPlayerTokenReq":
-		return s.OnGetPlayerTokenReq(from, to, data)
-	case "GetPlayerTokenRsp":
-		return s.OnGetPlayerTokenRsp(from, to, data)
-	case "UnionCmdNotify":
-		return s.OnUnionCmdNotify(from, to, data)
-	case "ClientAbilityChangeNotify":
-		return s.OnClientAbilityChangeNotify(from, to, data)
-	case "AbilityInvocationsNotify":
-		return s.OnAbilityInvocationsNotify(from, to, data)
-	case "CombatInvocationsNotify":
-		return s.OnCombatInvocationsNotify(from, to, data)
-	case "ClientSetGameTimeReq":
-		return s.OnClientSetGameTimeReq(from, to, head, data)
-	case "ChangeGameTimeRsp":
-		return s.OnChangeGameTimeRsp(from, to, head, data)
+type PacketHandler func(s *Session, from, to mapper.Protocol, head, data []byte) (*Result, error)
+
+// Action is what becomes of a handled packet.
+type Action uint8
+
+const (
+	// ActionForward sends the packet on, as rewritten by the handler.
+	ActionForward Action = iota
+	// ActionDrop sends nothing.
+	ActionDrop
+	// ActionReplace sends the packets of the result instead of the packet.
+	ActionReplace
+	// ActionInject sends the packet on, then the packets of the result.
+	ActionInject
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionDrop:
+		return "drop"
+	case ActionReplace:
+		return "replace"
+	case ActionInject:
+		return "inject"
 	}
-	if !s.config.Console.Enabled {
-		return data, nil
+	return "forward"
+}
+
+// Result is the outcome of a handled packet. Data is the packet sent on by
+// ActionForward and ActionInject, its JSON when returned by a handler and
+// serialized once converted.
+type Result struct {
+	Action  Action
+	Data    []byte
+	Packets []*Packet
+}
+
+func ForwardPacket(data []byte) *Result {
+	return &Result{Action: ActionForward, Data: data}
+}
+
+func DropPacket() *Result {
+	return &Result{Action: ActionDrop}
+}
+
+func ReplacePacket(packets ...*Packet) *Result {
+	return &Result{Action: ActionReplace, Packets: packets}
+}
+
+func InjectPackets(data []byte, packets ...*Packet) *Result {
+	return &Result{Action: ActionInject, Data: data, Packets: packets}
+}
+
+// Packet is a packet sent by a handler, Data is its JSON read in the protocol
+// of the side it is sent to. A Reply goes back to the sender of the handled
+// packet, the other packets go the way of the handled packet.
+type Packet struct {
+	Name  string
+	Data  []byte
+	Reply bool
+}
+
+// Direction is the way a packet goes through the proxy.
+type Direction uint8
+
+const (
+	DirectionAny Direction = iota
+	ClientToServer
+	ServerToClient
+)
+
+func (d Direction) String() string {
+	switch d {
+	case ClientToServer:
+		return "client->server"
+	case ServerToClient:
+		return "server->client"
 	}
-	switch name {
-	case "GetPlayerFriendListRsp":
-		return s.OnGetPlayerFriendListRsp(from, to, data)
-	case "PrivateChatReq":
-		return s.OnPrivateChatReq(from, to, head, data)
-	case "PullPrivateChatReq":
-		return s.OnPullPrivateChatReq(from, to, data)
-	case "PullRecentChatReq":
-		return s.OnPullRecentChatReq(from, to, data)
-	case "PullRecentChatRsp":
-		return s.OnPullRecentChatRsp(from, to, data)
-	case "MarkMapReq":
-		return s.OnMarkMapReq(from, to, head, data)
+	return "any"
+}
+
+// Handler is a registered handler of a packet, run on the packets of Message
+// going in Direction from a protocol in From to a protocol in To. The
+// handlers of a packet run by Priority, the lowest first, each one given the
+// packet returned by the previous one.
+type Handler struct {
+	// Name is unique, and enables or disables the handler in config.
+	Name      string
+	Message   string
+	Direction Direction
+	From, To  config.VersionRange
+	Priority  int
+	// Console handlers only run with the chat console enabled.
+	Console bool
+	Handle  PacketHandler
+}
+
+var handlers = make(map[string][]*Handler)
+
+// RegisterHandler adds the handler, it is meant to be called from init.
+func RegisterHandler(h *Handler) {
+	if findHandler(h.Name) != nil {
+		panic("handler " + h.Name + " registered twice")
 	}
-	return data, nil
+	handlers[h.Message] = sortHandlers(append(handlers[h.Message], h))
 }
 
-type UnionCmdNotify struct {
-	CmdList []*UnionCmd `json:"cmdList"`
+func findHandler(name string) *Handler {
+	for _, hs := range handlers {
+		for _, h := range hs {
+			if h.Name == name {
+				return h
+			}
+		}
+	}
+	return nil
 }
 
-type UnionCmd struct {
-	MessageID uint16 `json:"messageId"`
-	Body      []byte `json:"body"`
+func sortHandlers(hs []*Handler) []*Handler {
+	sort.SliceStable(hs, func(i, j int) bool { return hs[i].Priority < hs[j].Priority })
+	return hs
 }
 
-func (s *Session) OnUnionCmdNotify(from, to mapper.Protocol, data []byte) ([]byte, error) {
-	notify := new(UnionCmdNotify)
-	err := json.Unmarshal(data, notify)
-	if err != nil {
-		return data, err
+// Handlers returns the handlers of the packet enabled for the session.
+func (s *Session) Handlers(dir Direction, from, to mapper.Protocol, name string) []*Handler {
+	hs := handlers[name]
+	if configured := s.Service.substitutions[name]; len(configured) > 0 {
+		hs = sortHandlers(append(hs[:len(hs):len(hs)], configured...))
 	}
-	for _, cmd := range notify.CmdList {
-		name := s.mapping.CommandNameMap[from][cmd.MessageID]
-		cmd.MessageID = s.mapping.CommandPairMap[from][to][cmd.MessageID]
-		cmd.Body, err = s.ConvertPacketByName(from, to, name, cmd.Body)
+	var enabled []*Handler
+	for _, h := range hs {
+		if h.Direction != DirectionAny && h.Direction != dir {
+			continue
+		}
+		if !h.From.ContainsProtocol(from) || !h.To.ContainsProtocol(to) {
+			continue
+		}
+		if h.Console && !s.config.Console.Enabled {
+			continue
+		}
+		if on, ok := s.Service.config.Handlers[h.Name]; ok && !on {
+			continue
+		}
+		enabled = append(enabled, h)
+	}
+	return enabled
+}
+
+// HandlePacket runs the handlers until one drops or replaces the packet, the
+// packets injected by the handlers run before are kept.
+func (s *Session) HandlePacket(handlers []*Handler, from, to mapper.Protocol, head, data []byte) (*Result, error) {
+	result := ForwardPacket(data)
+	for _, h := range handlers {
+		r, err := h.Handle(s, from, to, head, result.Data)
 		if err != nil {
-			return data, err
+			return nil, fmt.Errorf("handler %s failed: %w", h.Name, err)
+		}
+		packets := append(result.Packets, r.Packets...)
+		switch r.Action {
+		case ActionForward, ActionInject:
+			result.Data = r.Data
+			result.Packets = packets
+			if len(packets) > 0 {
+				result.Action = ActionInject
+			}
+		case ActionDrop, ActionReplace:
+			if len(packets) == 0 {
+				return DropPacket(), nil
+			}
+			return ReplacePacket(packets...), nil
+		default:
+			return nil, fmt.Errorf("handler %s returned unknown action %d", h.Name, r.Action)
 		}
 	}
-	return json.Marshal(notify)
+	return result, nil
 }
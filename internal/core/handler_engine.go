@@ -5,14 +5,38 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Jx2f/ViaGenshin/internal/config"
 	"github.com/Jx2f/ViaGenshin/internal/mapper"
 	"github.com/Jx2f/ViaGenshin/pkg/logger"
-	"github.com/Jx2f/ViaGenshin/pkg/transport/kcp"
 )
 
+func init() {
+	RegisterSubstitution(&config.ConfigSubstitution{
+		Name:             "game-time",
+		Request:          "ClientSetGameTimeReq",
+		UpstreamRequest:  "ChangeGameTimeReq",
+		UpstreamResponse: "ChangeGameTimeRsp",
+		Response:         "ClientSetGameTimeRsp",
+		RequestFields: map[string]string{
+			"gameTime":  "gameTime % 1440",
+			"extraDays": "(gameTime - clientGameTime) / 1440",
+		},
+		ResponseFields: map[string]string{
+			"gameTime":       "request.gameTime",
+			"clientGameTime": "request.clientGameTime",
+		},
+	})
+	RegisterHandler(&Handler{Name: "console-friend-list", Message: "GetPlayerFriendListRsp", Direction: ServerToClient, Console: true, Handle: (*Session).OnGetPlayerFriendListRsp})
+	RegisterHandler(&Handler{Name: "console-private-chat", Message: "PrivateChatReq", Direction: ClientToServer, Console: true, Handle: (*Session).OnPrivateChatReq})
+	RegisterHandler(&Handler{Name: "console-pull-private-chat", Message: "PullPrivateChatReq", Direction: ClientToServer, Console: true, Handle: (*Session).OnPullPrivateChatReq})
+	RegisterHandler(&Handler{Name: "console-pull-recent-chat-req", Message: "PullRecentChatReq", Direction: ClientToServer, Console: true, Handle: (*Session).OnPullRecentChatReq})
+	RegisterHandler(&Handler{Name: "console-pull-recent-chat-rsp", Message: "PullRecentChatRsp", Direction: ServerToClient, Console: true, Handle: (*Session).OnPullRecentChatRsp})
+	RegisterHandler(&Handler{Name: "console-mark-map", Message: "MarkMapReq", Direction: ClientToServer, Console: true, Handle: (*Session).OnMarkMapReq})
+}
+
 type Engine struct {
-	cachedPullRecentChat    *PullRecentChatReq
-	cachedClientSetGameTime *ClientSetGameTimeReq
+	cachedPullRecentChat *PullRecentChatReq
+	substituted          substitutedRequests
 }
 
 type SystemHint struct {
@@ -34,15 +58,15 @@ type PrivateChatNotify struct {
 	ChatInfo *ChatInfo `json:"chatInfo,omitempty"`
 }
 
-func (s *Session) NotifyPrivateChat(toSession *kcp.Session, to mapper.Protocol, head []byte, chatInfo *ChatInfo) error {
+func (s *Session) NotifyPrivateChat(chatInfo *ChatInfo) (*Packet, error) {
 	packet := new(PrivateChatNotify)
 	packet.ChatInfo = chatInfo
 	data, err := json.Marshal(packet)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logger.Debug().Msgf("Injecting PrivateChatNotify: %s", data)
-	return s.SendPacketJSON(toSession, to, "PrivateChatNotify", head, data)
+	return &Packet{Name: "PrivateChatNotify", Data: data, Reply: true}, nil
 }
 
 type PrivateChatReq struct {
@@ -56,50 +80,49 @@ type PrivateChatRsp struct {
 	Retcode              int32  `json:"retcode,omitempty"`
 }
 
-func (s *Session) OnPrivateChatReq(from, to mapper.Protocol, head, data []byte) ([]byte, error) {
+func (s *Session) OnPrivateChatReq(from, to mapper.Protocol, head, data []byte) (*Result, error) {
 	in := new(PrivateChatReq)
 	err := json.Unmarshal(data, &in)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	if in.TargetUid != consoleUid {
-		return data, nil
+		return ForwardPacket(data), nil
 	}
 	logger.Debug().Msgf("Injecting PrivateChatReq: %s", data)
-	if err = s.NotifyPrivateChat(s.endpoint, from, head, &ChatInfo{
+	sent, err := s.NotifyPrivateChat(&ChatInfo{
 		Time:  uint32(time.Now().Unix()),
 		ToUid: consoleUid,
 		Uid:   s.playerUid,
 		Text:  in.Text,
 		Icon:  in.Icon,
-	}); err != nil {
-		return data, err
+	})
+	if err != nil {
+		return nil, err
 	}
 	if in.Text == "" {
-		return data, nil
+		return InjectPackets(data, sent), nil
 	}
 	in.Text, err = s.ConsoleExecute(1116, s.playerUid, in.Text)
 	if err != nil {
 		in.Text = fmt.Sprintf("执行命令失败: %s", err)
 	}
-	if err = s.NotifyPrivateChat(s.endpoint, from, head, &ChatInfo{
+	answer, err := s.NotifyPrivateChat(&ChatInfo{
 		Time:  uint32(time.Now().Unix()),
 		ToUid: s.playerUid,
 		Uid:   consoleUid,
 		Text:  in.Text,
-	}); err != nil {
-		return data, err
+	})
+	if err != nil {
+		return nil, err
 	}
 	out := new(PrivateChatRsp)
 	p, err := json.Marshal(out)
 	if err != nil {
-		return data, err
-	}
-	logger.Debug().Msgf("Injecting PrivateChatRsp: %s", data)
-	if err = s.SendPacketJSON(s.endpoint, to, "PrivateChatRsp", head, p); err != nil {
-		return data, err
+		return nil, err
 	}
-	return data, fmt.Errorf("injected PrivateChatReq")
+	logger.Debug().Msgf("Injecting PrivateChatRsp: %s", p)
+	return ReplacePacket(sent, answer, &Packet{Name: "PrivateChatRsp", Data: p, Reply: true}), nil
 }
 
 type PullPrivateChatReq struct {
@@ -113,20 +136,20 @@ type PullPrivateChatRsp struct {
 	Retcode  int32       `json:"retcode,omitempty"`
 }
 
-func (s *Session) OnPullPrivateChatReq(from, to mapper.Protocol, data []byte) ([]byte, error) {
+func (s *Session) OnPullPrivateChatReq(from, to mapper.Protocol, head, data []byte) (*Result, error) {
 	in := new(PullPrivateChatReq)
 	err := json.Unmarshal(data, &in)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	if in.TargetUid != consoleUid {
-		return data, nil
+		return ForwardPacket(data), nil
 	}
 	logger.Debug().Msgf("Injecting PullPrivateChatReq: %s", data)
 	out := new(PullPrivateChatRsp)
 	err = json.Unmarshal(data, &out)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	out.ChatInfo = append(out.ChatInfo, &ChatInfo{
 		Time:  uint32(time.Now().Unix()),
@@ -137,10 +160,10 @@ func (s *Session) OnPullPrivateChatReq(from, to mapper.Protocol, data []byte) ([
 	out.Retcode = 0
 	p, err := json.Marshal(out)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	logger.Debug().Msgf("Injecting PullPrivateChatRsp: %s", p)
-	return data, fmt.Errorf("injected PullPrivateChatReq")
+	return ReplacePacket(&Packet{Name: "PullPrivateChatRsp", Data: p, Reply: true}), nil
 }
 
 type PullRecentChatReq struct {
@@ -148,18 +171,18 @@ type PullRecentChatReq struct {
 	BeginSequence uint32 `json:"beginSequence,omitempty"`
 }
 
-func (s *Session) OnPullRecentChatReq(from, to mapper.Protocol, data []byte) ([]byte, error) {
+func (s *Session) OnPullRecentChatReq(from, to mapper.Protocol, head, data []byte) (*Result, error) {
 	packet := new(PullRecentChatReq)
 	err := json.Unmarshal(data, &packet)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	if packet.BeginSequence != 0 {
-		return data, nil
+		return ForwardPacket(data), nil
 	}
 	s.cachedPullRecentChat = packet
 	logger.Debug().Msgf("Injecting PullRecentChatReq: %s", data)
-	return data, nil
+	return ForwardPacket(data), nil
 }
 
 type PullRecentChatRsp struct {
@@ -167,15 +190,15 @@ type PullRecentChatRsp struct {
 	Retcode  int32       `json:"retcode,omitempty"`
 }
 
-func (s *Session) OnPullRecentChatRsp(from, to mapper.Protocol, data []byte) ([]byte, error) {
+func (s *Session) OnPullRecentChatRsp(from, to mapper.Protocol, head, data []byte) (*Result, error) {
 	if s.cachedPullRecentChat == nil || s.cachedPullRecentChat.BeginSequence != 0 {
-		return data, nil
+		return ForwardPacket(data), nil
 	}
 	s.cachedPullRecentChat = nil
 	packet := new(PullRecentChatRsp)
 	err := json.Unmarshal(data, &packet)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	packet.ChatInfo = append(packet.ChatInfo, &ChatInfo{
 		Time:  uint32(time.Now().Unix()),
@@ -186,10 +209,10 @@ func (s *Session) OnPullRecentChatRsp(from, to mapper.Protocol, data []byte) ([]
 	packet.Retcode = 0
 	data, err = json.Marshal(packet)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	logger.Debug().Msgf("Injecting PullRecentChatRsp: %s", data)
-	return data, nil
+	return ForwardPacket(data), nil
 }
 
 type GetPlayerFriendListRsp struct {
@@ -198,11 +221,11 @@ type GetPlayerFriendListRsp struct {
 	FriendList    []*map[string]any `json:"friendList,omitempty"`
 }
 
-func (s *Session) OnGetPlayerFriendListRsp(from, to mapper.Protocol, data []byte) ([]byte, error) {
+func (s *Session) OnGetPlayerFriendListRsp(from, to mapper.Protocol, head, data []byte) (*Result, error) {
 	packet := new(GetPlayerFriendListRsp)
 	err := json.Unmarshal(data, &packet)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	packet.FriendList = append(packet.FriendList, &map[string]any{
 		"uid":        consoleUid,
@@ -221,10 +244,10 @@ func (s *Session) OnGetPlayerFriendListRsp(from, to mapper.Protocol, data []byte
 	})
 	data, err = json.Marshal(packet)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	logger.Debug().Msgf("Injecting GetPlayerFriendListRsp: %s", data)
-	return data, nil
+	return ForwardPacket(data), nil
 }
 
 type Vector struct {
@@ -249,14 +272,14 @@ type MarkMapReq struct {
 	Mark *MapMarkPoint `json:"mark,omitempty"`
 }
 
-func (s *Session) OnMarkMapReq(from, to mapper.Protocol, head, data []byte) ([]byte, error) {
+func (s *Session) OnMarkMapReq(from, to mapper.Protocol, head, data []byte) (*Result, error) {
 	packet := new(MarkMapReq)
 	err := json.Unmarshal(data, &packet)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	if !(packet.Mark != nil && packet.Mark.Name == "goto" && packet.Mark.Pos != nil) {
-		return data, nil
+		return ForwardPacket(data), nil
 	}
 	if packet.Mark.Pos.Y == 0 {
 		packet.Mark.Pos.Y = 500
@@ -264,82 +287,7 @@ func (s *Session) OnMarkMapReq(from, to mapper.Protocol, head, data []byte) ([]b
 	logger.Debug().Msgf("Injecting MarkMapReq: %s", data)
 	_, err = s.ConsoleExecute(1116, s.playerUid, fmt.Sprintf("goto %f %f %f", packet.Mark.Pos.X, packet.Mark.Pos.Y, packet.Mark.Pos.Z))
 	if err != nil {
-		return data, err
-	}
-	return data, fmt.Errorf("injected MarkMapReq")
-}
-
-type ChangeGameTimeReq struct {
-	IsForceSet bool   `json:"isForceSet,omitempty"`
-	GameTime   uint32 `json:"gameTime,omitempty"`
-	ExtraDays  uint32 `json:"extraDays,omitempty"`
-}
-
-type ClientSetGameTimeReq struct {
-	IsForceSet     bool   `json:"isForceSet,omitempty"`
-	GameTime       uint32 `json:"gameTime,omitempty"`
-	ClientGameTime uint32 `json:"clientGameTime,omitempty"`
-}
-
-func (s *Session) OnClientSetGameTimeReq(from, to mapper.Protocol, head, data []byte) ([]byte, error) {
-	in := new(ClientSetGameTimeReq)
-	err := json.Unmarshal(data, &in)
-	if err != nil {
-		return data, err
-	}
-	s.cachedClientSetGameTime = in
-	out := new(ChangeGameTimeReq)
-	out.IsForceSet = in.IsForceSet
-	out.GameTime = in.GameTime % 1440
-	out.ExtraDays = (in.GameTime - in.ClientGameTime) / 1440
-	p, err := json.Marshal(out)
-	if err != nil {
-		return data, err
-	}
-	logger.Debug().RawJSON("from", data).RawJSON("to", p).
-		Msgf("Rewriting %s: ClientSetGameTimeReq to %s:ChangeGameTimeReq", from, to)
-	err = s.SendPacketJSON(s.upstream, to, "ChangeGameTimeReq", head, p)
-	if err != nil {
-		return data, err
-	}
-	return data, fmt.Errorf("injected ChangeGameTimeReq")
-}
-
-type ChangeGameTimeRsp struct {
-	Retcode   int32  `json:"retcode,omitempty"`
-	GameTime  uint32 `json:"gameTime,omitempty"`
-	ExtraDays uint32 `json:"extraDays,omitempty"`
-}
-
-type ClientSetGameTimeRsp struct {
-	Retcode        int32  `json:"retcode,omitempty"`
-	GameTime       uint32 `json:"gameTime,omitempty"`
-	ClientGameTime uint32 `json:"clientGameTime,omitempty"`
-}
-
-func (s *Session) OnChangeGameTimeRsp(from, to mapper.Protocol, head, data []byte) ([]byte, error) {
-	if s.cachedClientSetGameTime == nil {
-		return data, nil
-	}
-	in := new(ChangeGameTimeRsp)
-	err := json.Unmarshal(data, &in)
-	if err != nil {
-		return data, err
-	}
-	logger.Debug().Msgf("Injecting ChangeGameTimeRsp: %s", data)
-	out := new(ClientSetGameTimeRsp)
-	out.GameTime = s.cachedClientSetGameTime.GameTime
-	out.ClientGameTime = s.cachedClientSetGameTime.ClientGameTime
-	s.cachedClientSetGameTime = nil
-	p, err := json.Marshal(out)
-	if err != nil {
-		return data, err
-	}
-	logger.Debug().RawJSON("from", data).RawJSON("to", p).
-		Msgf("Rewriting %s: ChangeGameTimeRsp to %s:ClientSetGameTimeRsp", from, to)
-	err = s.SendPacketJSON(s.endpoint, to, "ClientSetGameTimeRsp", head, p)
-	if err != nil {
-		return data, err
+		return nil, err
 	}
-	return data, fmt.Errorf("injected ClientSetGameTimeRsp")
+	return DropPacket(), nil
 }
@@ -8,23 +8,28 @@ import (
 	"github.com/Jx2f/ViaGenshin/pkg/crypto/mt19937"
 )
 
+func init() {
+	RegisterHandler(&Handler{Name: "login-token-req", Message: "GetPlayerTokenReq", Direction: ClientToServer, Handle: (*Session).OnGetPlayerTokenReq})
+	RegisterHandler(&Handler{Name: "login-token-rsp", Message: "GetPlayerTokenRsp", Direction: ServerToClient, Handle: (*Session).OnGetPlayerTokenRsp})
+}
+
 type GetPlayerTokenReq struct {
 	KeyID         uint32 `json:"keyId,omitempty"`
 	ClientRandKey string `json:"clientRandKey,omitempty"`
 }
 
-func (s *Session) OnGetPlayerTokenReq(from, to mapper.Protocol, data []byte) ([]byte, error) {
+func (s *Session) OnGetPlayerTokenReq(from, to mapper.Protocol, head, data []byte) (*Result, error) {
 	packet := new(GetPlayerTokenReq)
 	err := json.Unmarshal(data, &packet)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	seed, err := s.keys.ServerKey.DecryptBase64(packet.ClientRandKey)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	s.loginRand = binary.BigEndian.Uint64(seed)
-	return data, nil
+	return ForwardPacket(data), nil
 }
 
 type GetPlayerTokenRsp struct {
@@ -33,17 +38,17 @@ type GetPlayerTokenRsp struct {
 	ServerRandKey string `json:"serverRandKey,omitempty"`
 }
 
-func (s *Session) OnGetPlayerTokenRsp(from, to mapper.Protocol, data []byte) ([]byte, error) {
+func (s *Session) OnGetPlayerTokenRsp(from, to mapper.Protocol, head, data []byte) (*Result, error) {
 	packet := new(GetPlayerTokenRsp)
 	err := json.Unmarshal(data, &packet)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	s.playerUid = packet.Uid
 	seed, err := s.keys.ClientKeys[packet.KeyID].DecryptBase64(packet.ServerRandKey)
 	if err != nil {
-		return data, err
+		return nil, err
 	}
 	s.loginKey = mt19937.NewKeyBlock(s.loginRand ^ binary.BigEndian.Uint64(seed))
-	return data, nil
+	return ForwardPacket(data), nil
 }
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+// newTestMapping writes the proto files of each protocol, by message name,
+// with the command table of the commands, and loads the mapping of them.
+func newTestMapping(t *testing.T, base mapper.Protocol, protocols map[mapper.Protocol]map[string]string, commands map[mapper.Protocol]string) *mapper.Mapping {
+	t.Helper()
+	c := newTestProtocols(t, base, protocols, commands)
+	m, err := mapper.NewMappingFromConfig(c)
+	if err != nil {
+		t.Fatalf("failed to load mapping: %v", err)
+	}
+	return m
+}
+
+// newTestProtocols writes the protocols as newTestMapping does, and returns
+// their config.
+func newTestProtocols(t *testing.T, base mapper.Protocol, protocols map[mapper.Protocol]map[string]string, commands map[mapper.Protocol]string) *config.ConfigProtocols {
+	t.Helper()
+	dir := t.TempDir()
+	c := &config.ConfigProtocols{BaseProtocol: base, Mapping: make(map[mapper.Protocol]string)}
+	for v, messages := range protocols {
+		c.Mapping[v] = filepath.Join(dir, string(v))
+		writeTestProtocol(t, c.Mapping[v], messages, commands[v])
+	}
+	return c
+}
+
+// writeTestProtocol writes the proto files, by message name, and the command
+// table of a protocol in the directory.
+func writeTestProtocol(t *testing.T, root string, messages map[string]string, commands string) {
+	t.Helper()
+	files := map[string]string{
+		"protocol.csv":   commands,
+		"arguments.json": `{"ability": [], "combat": []}`,
+	}
+	for name, content := range messages {
+		files[filepath.Join("protocol", name+".proto")] = "syntax = \"proto3\";\n" + content
+	}
+	for name, content := range files {
+		file := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestSession returns a session of the mapping without connections, the
+// handlers of the messages run besides the registered ones.
+func newTestSession(m *mapper.Mapping, handlers map[string][]*Handler) *Session {
+	s := NewService(&config.Config{})
+	s.mapping.Store(m)
+	s.substitutions = handlers
+	return newSession(&Server{Service: s, config: &config.ConfigEndpoints{}}, nil)
+}
+
+func TestHandlePacket(t *testing.T) {
+	forward := func(data string, packets ...*Packet) PacketHandler {
+		return func(s *Session, from, to mapper.Protocol, head, _ []byte) (*Result, error) {
+			if len(packets) > 0 {
+				return InjectPackets([]byte(data), packets...), nil
+			}
+			return ForwardPacket([]byte(data)), nil
+		}
+	}
+	drop := func(s *Session, from, to mapper.Protocol, head, data []byte) (*Result, error) {
+		return DropPacket(), nil
+	}
+	a, b := &Packet{Name: "A"}, &Packet{Name: "B", Reply: true}
+	tests := []struct {
+		name     string
+		handlers []PacketHandler
+		action   Action
+		data     string
+		packets  []*Packet
+	}{
+		{"forward", []PacketHandler{forward("1"), forward("2")}, ActionForward, "2", nil},
+		{"inject", []PacketHandler{forward("1", a), forward("2", b)}, ActionInject, "2", []*Packet{a, b}},
+		{"drop", []PacketHandler{forward("1"), drop, forward("2", a)}, ActionDrop, "", nil},
+		{"drop after inject", []PacketHandler{forward("1", a), drop}, ActionReplace, "", []*Packet{a}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hs []*Handler
+			for _, h := range tt.handlers {
+				hs = append(hs, &Handler{Name: tt.name, Handle: h})
+			}
+			result, err := newTestSession(nil, nil).HandlePacket(hs, "v1", "v2", nil, []byte("0"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Action != tt.action || string(result.Data) != tt.data || len(result.Packets) != len(tt.packets) {
+				t.Fatalf("got %s %q %v, want %s %q %v", result.Action, result.Data, result.Packets, tt.action, tt.data, tt.packets)
+			}
+			for i, p := range tt.packets {
+				if result.Packets[i] != p {
+					t.Errorf("packet %d = %v, want %v", i, result.Packets[i], p)
+				}
+			}
+		})
+	}
+}
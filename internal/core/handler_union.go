@@ -0,0 +1,113 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+func init() {
+	RegisterHandler(&Handler{Name: "union-cmd", Message: "UnionCmdNotify", Direction: ClientToServer, Handle: (*Session).OnUnionCmdNotify})
+}
+
+type UnionCmdNotify struct {
+	CmdList []*UnionCmd `json:"cmdList"`
+}
+
+type UnionCmd struct {
+	MessageID uint16 `json:"messageId"`
+	Body      []byte `json:"body"`
+}
+
+// OnUnionCmdNotify runs the handlers of the commands inside the notify, the
+// converter converts them afterwards. A dropped command is removed, the
+// packets a handler sends are sent after the notify, as they are already in
+// the protocol of the server, and the replies are sent back to the client.
+func (s *Session) OnUnionCmdNotify(from, to mapper.Protocol, head, data []byte) (*Result, error) {
+	notify := new(UnionCmdNotify)
+	err := json.Unmarshal(data, notify)
+	if err != nil {
+		return nil, err
+	}
+	m := s.Mapping()
+	var changed bool
+	var cmdList []*UnionCmd
+	var packets []*Packet
+	for _, cmd := range notify.CmdList {
+		name := m.CommandNameMap[from][cmd.MessageID]
+		handlers := s.Handlers(ClientToServer, from, to, name)
+		if len(handlers) == 0 {
+			cmdList = append(cmdList, cmd)
+			continue
+		}
+		result, err := s.handleCommand(m, handlers, from, to, name, head, cmd.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to handle %s in UnionCmdNotify: %w", name, err)
+		}
+		if result.Action == ActionForward || result.Action == ActionInject {
+			if result.Data != nil {
+				cmd = &UnionCmd{MessageID: cmd.MessageID, Body: result.Data}
+			}
+			cmdList = append(cmdList, cmd)
+		}
+		if result.Action == ActionForward && result.Data == nil {
+			continue
+		}
+		changed = true
+		logger.Debug().Msgf("Command %s in UnionCmdNotify handled with %s", name, result.Action)
+		packets = append(packets, result.Packets...)
+	}
+	if !changed {
+		return ForwardPacket(data), nil
+	}
+	if len(cmdList) == 0 {
+		if len(packets) == 0 {
+			return DropPacket(), nil
+		}
+		return ReplacePacket(packets...), nil
+	}
+	notify.CmdList = cmdList
+	if data, err = json.Marshal(notify); err != nil {
+		return nil, err
+	}
+	if len(packets) == 0 {
+		return ForwardPacket(data), nil
+	}
+	return InjectPackets(data, packets...), nil
+}
+
+// handleCommand runs the handlers on a serialized command, the Data of the
+// result is the serialized command, nil if it is unchanged.
+func (s *Session) handleCommand(m *mapper.Mapping, handlers []*Handler, from, to mapper.Protocol, name string, head, body []byte) (*Result, error) {
+	fromDesc := m.MessageDescMap[from][name]
+	if fromDesc == nil {
+		return nil, fmt.Errorf("unknown from message %s in %s", name, from)
+	}
+	packet := dynamic.NewMessage(fromDesc)
+	if err := packet.Unmarshal(body); err != nil {
+		return nil, err
+	}
+	fromJson, err := packet.MarshalJSONPB(MarshalOptions)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.HandlePacket(handlers, from, to, head, fromJson)
+	if err != nil {
+		return nil, err
+	}
+	if result.Action != ActionForward && result.Action != ActionInject {
+		return result, nil
+	}
+	if string(result.Data) == string(fromJson) {
+		result.Data = nil
+		return result, nil
+	}
+	if result.Data, err = MarshalPacketJSON(m, from, name, result.Data); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+func TestUnionCmdNotify(t *testing.T) {
+	union := `message UnionCmd { uint32 message_id = 1; bytes body = 2; }
+message UnionCmdNotify { repeated UnionCmd cmd_list = 1; }`
+	m := newTestMapping(t, "v1", map[mapper.Protocol]map[string]string{
+		"v1": {
+			"UnionCmdNotify": union,
+			"PingReq":        `message PingReq { uint32 seq = 1; }`,
+			"PingRsp":        `message PingRsp { uint32 seq = 1; }`,
+			"MoveReq":        `message MoveReq { uint32 x = 1; }`,
+			"DropReq":        `message DropReq { uint32 x = 1; }`,
+		},
+		"v2": {
+			"UnionCmdNotify": union,
+			"PingReq":        `message PingReq { uint32 seq = 1; }`,
+			"PingRsp":        `message PingRsp { uint32 seq = 1; }`,
+			"MoveReq":        `message MoveReq { uint32 x = 1; }`,
+			"DropReq":        `message DropReq { uint32 x = 1; }`,
+			"HelloNotify":    `message HelloNotify { uint32 seq = 1; }`,
+		},
+	}, map[mapper.Protocol]string{
+		"v1": "UnionCmdNotify,100\nPingReq,10\nPingRsp,11\nMoveReq,12\nDropReq,13\n",
+		"v2": "UnionCmdNotify,200\nPingReq,20\nPingRsp,21\nMoveReq,22\nDropReq,23\nHelloNotify,24\n",
+	})
+	hello := &Packet{Name: "HelloNotify", Data: []byte(`{"seq":3}`)}
+	reply := &Packet{Name: "PingRsp", Data: []byte(`{"seq":3}`), Reply: true}
+	s := newTestSession(m, map[string][]*Handler{
+		"PingReq": {{Name: "test-ping", Message: "PingReq", Direction: ClientToServer,
+			Handle: func(s *Session, from, to mapper.Protocol, head, data []byte) (*Result, error) {
+				return InjectPackets(data, hello, reply), nil
+			},
+		}},
+		"DropReq": {{Name: "test-drop", Message: "DropReq", Direction: ClientToServer,
+			Handle: func(s *Session, from, to mapper.Protocol, head, data []byte) (*Result, error) {
+				return DropPacket(), nil
+			},
+		}},
+	})
+	notify := func(cmds ...*UnionCmd) []byte {
+		data, err := json.Marshal(&UnionCmdNotify{CmdList: cmds})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	ping, err := MarshalPacketJSON(m, "v1", "PingReq", []byte(`{"seq":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	move := &UnionCmd{MessageID: 12, Body: []byte{8, 1}}
+
+	result, err := s.OnUnionCmdNotify("v1", "v2", nil, notify(move, &UnionCmd{MessageID: 10, Body: ping}, &UnionCmd{MessageID: 13}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionInject {
+		t.Fatalf("action = %s, want %s", result.Action, ActionInject)
+	}
+	// The dropped command is removed, the injected packets are not added to
+	// the notify, which is still in the protocol of the client.
+	if want := notify(move, &UnionCmd{MessageID: 10, Body: ping}); string(result.Data) != string(want) {
+		t.Errorf("notify = %s, want %s", result.Data, want)
+	}
+	if len(result.Packets) != 2 || result.Packets[0] != hello || result.Packets[1] != reply {
+		t.Fatalf("packets = %v, want the injected packet and the reply", result.Packets)
+	}
+	// The injected packet is read in the protocol of the server.
+	if _, err := MarshalPacketJSON(m, "v2", hello.Name, hello.Data); err != nil {
+		t.Error(err)
+	}
+
+	result, err = s.OnUnionCmdNotify("v1", "v2", nil, notify(&UnionCmd{MessageID: 13}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionDrop {
+		t.Errorf("action = %s, want %s", result.Action, ActionDrop)
+	}
+
+	result, err = s.OnUnionCmdNotify("v1", "v2", nil, notify(move))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != ActionForward {
+		t.Errorf("action = %s, want %s", result.Action, ActionForward)
+	}
+}
+
+func TestSendPacketJSONUnknownCommand(t *testing.T) {
+	m := newTestMapping(t, "v1", map[mapper.Protocol]map[string]string{
+		"v1": {"PingReq": `message PingReq { uint32 seq = 1; }`},
+	}, map[mapper.Protocol]string{"v1": "PingReq,10\n"})
+	err := newTestSession(m, nil).SendPacketJSON(nil, "v1", "HelloNotify", nil, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "unknown command HelloNotify") {
+		t.Errorf("got error %v, want an unknown command", err)
+	}
+}
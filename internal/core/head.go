@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+// The fields of PacketHead written by the proxy.
+const (
+	headClientSequenceID = "client_sequence_id"
+	headSentMs           = "sent_ms"
+)
+
+// DecodeHead decodes the head of a packet with the PacketHead of the protocol,
+// it returns nil if the protocol has no PacketHead.
+func DecodeHead(m *mapper.Mapping, v mapper.Protocol, head []byte) (*dynamic.Message, error) {
+	md := m.MessageDescMap[v][mapper.PacketHead]
+	if md == nil {
+		return nil, nil
+	}
+	msg := dynamic.NewMessage(md)
+	if err := msg.Unmarshal(head); err != nil {
+		return nil, fmt.Errorf("failed to decode %s of %s: %w", mapper.PacketHead, v, err)
+	}
+	return msg, nil
+}
+
+// ClientSequenceID returns the client_sequence_id of the head, 0 if the head
+// has none.
+func ClientSequenceID(m *mapper.Mapping, v mapper.Protocol, head []byte) uint32 {
+	msg, err := DecodeHead(m, v, head)
+	if msg == nil || err != nil {
+		return 0
+	}
+	seq, _ := msg.TryGetFieldByName(headClientSequenceID)
+	n, _ := seq.(uint32)
+	return n
+}
+
+// NewHead returns a head of the protocol with the client sequence id, sent
+// now. The head is empty if the protocol has no PacketHead.
+func NewHead(m *mapper.Mapping, v mapper.Protocol, seq uint32) ([]byte, error) {
+	md := m.MessageDescMap[v][mapper.PacketHead]
+	if md == nil {
+		return nil, nil
+	}
+	return encodeHead(dynamic.NewMessage(md), seq)
+}
+
+// encodeHead sets the client sequence id, unless it is 0, and the current
+// time on the head.
+func encodeHead(msg *dynamic.Message, seq uint32) ([]byte, error) {
+	if seq != 0 {
+		setHeadField(msg, headClientSequenceID, uint64(seq))
+	}
+	setHeadField(msg, headSentMs, uint64(time.Now().UnixMilli()))
+	return msg.Marshal()
+}
+
+func setHeadField(msg *dynamic.Message, name string, value uint64) {
+	fd := msg.GetMessageDescriptor().FindFieldByName(name)
+	if fd == nil || fd.IsRepeated() {
+		return
+	}
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		msg.SetField(fd, uint32(value))
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		msg.SetField(fd, value)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		msg.SetField(fd, int32(value))
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		msg.SetField(fd, int64(value))
+	}
+}
+
+// isRpc tells if the command is a request or a response, whose head carries
+// the client sequence id of the request.
+func isRpc(name string) bool {
+	return strings.HasSuffix(name, "Req") || strings.HasSuffix(name, "Rsp")
+}
+
+// injectedHead returns the head of a packet sent by a handler of the packet
+// of from with head. A request or a response sent on replaces the handled
+// packet and keeps its head, a reply to it answers its client sequence id,
+// the other packets are new and get a new head.
+func (s *Session) injectedHead(m *mapper.Mapping, from, v mapper.Protocol, p *Packet, head []byte, toClient bool) ([]byte, error) {
+	if !isRpc(p.Name) {
+		return s.notifyHead(m, v, toClient)
+	}
+	handled, err := DecodeHead(m, from, head)
+	if err != nil {
+		return nil, err
+	}
+	if handled == nil || m.MessageDescMap[v][mapper.PacketHead] == nil {
+		return head, nil
+	}
+	seq, _ := handled.TryGetFieldByName(headClientSequenceID)
+	n, _ := seq.(uint32)
+	if n == 0 {
+		n = s.clientSeq.Load()
+	}
+	if !p.Reply {
+		return encodeHead(handled, n)
+	}
+	return NewHead(m, v, n)
+}
+
+// notifyHead returns the head of a notify built by the proxy. A notify sent
+// to the client carries the last client sequence id answered by the server,
+// as the notifies of the server do.
+func (s *Session) notifyHead(m *mapper.Mapping, v mapper.Protocol, toClient bool) ([]byte, error) {
+	if !toClient {
+		return NewHead(m, v, 0)
+	}
+	return NewHead(m, v, s.serverSeq.Load())
+}
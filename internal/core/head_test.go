@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/crypto/mt19937"
+	"github.com/Jx2f/ViaGenshin/pkg/transport"
+)
+
+func TestInjectedHead(t *testing.T) {
+	head := `message PacketHead { uint32 client_sequence_id = 2; uint64 sent_ms = 4; uint32 rpc_id = 11; }`
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {"PacketHead": head, "PingReq": `message PingReq {}`},
+		"v2.0.0": {"PacketHead": head, "PingReq": `message PingReq {}`},
+	}, map[mapper.Protocol]string{"v1.0.0": "PingReq,1\n", "v2.0.0": "PingReq,1\n"})
+	s := newTestSession(m, nil)
+	s.clientSeq.Store(7)
+	s.serverSeq.Store(5)
+
+	md := m.MessageDescMap["v1.0.0"][mapper.PacketHead]
+	msg := dynamic.NewMessage(md)
+	msg.SetFieldByName(headClientSequenceID, uint32(9))
+	msg.SetFieldByName("rpc_id", uint32(3))
+	handled, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		packet   *Packet
+		head     []byte
+		toClient bool
+		seq      uint32
+		rpcID    uint32
+	}{
+		{"notify to the client", &Packet{Name: "HelloNotify"}, handled, true, 5, 0},
+		{"notify to the server", &Packet{Name: "HelloNotify"}, handled, false, 0, 0},
+		{"request sent on", &Packet{Name: "PingReq"}, handled, false, 9, 3},
+		{"reply", &Packet{Name: "PingRsp", Reply: true}, handled, true, 9, 0},
+		{"reply without sequence id", &Packet{Name: "PingRsp", Reply: true}, nil, true, 7, 0},
+	}
+	for _, tt := range tests {
+		b, err := s.injectedHead(m, "v1.0.0", "v2.0.0", tt.packet, tt.head, tt.toClient)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		msg, err := DecodeHead(m, "v2.0.0", b)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if seq := msg.GetFieldByName(headClientSequenceID).(uint32); seq != tt.seq {
+			t.Errorf("%s: client sequence id %d, want %d", tt.name, seq, tt.seq)
+		}
+		if id := msg.GetFieldByName("rpc_id").(uint32); id != tt.rpcID {
+			t.Errorf("%s: rpc id %d, want %d", tt.name, id, tt.rpcID)
+		}
+		if msg.GetFieldByName(headSentMs).(uint64) == 0 {
+			t.Errorf("%s: no sent time", tt.name)
+		}
+	}
+}
+
+// encodeTestPayload returns the payload of the packet encrypted with the
+// login key of the session, as ConvertPayload receives it.
+func encodeTestPayload(s *Session, cmd uint16, head, data []byte) transport.Payload {
+	b := bytes.NewBuffer([]byte{0x45, 0x67})
+	binary.Write(b, binary.BigEndian, cmd)
+	binary.Write(b, binary.BigEndian, uint16(len(head)))
+	binary.Write(b, binary.BigEndian, uint32(len(data)))
+	b.Write(head)
+	b.Write(data)
+	b.Write([]byte{0x89, 0xAB})
+	payload := b.Bytes()
+	s.loginKey.Xor(payload)
+	return payload
+}
+
+func TestSessionSequence(t *testing.T) {
+	head := `message PacketHead { uint32 client_sequence_id = 2; }`
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {"PacketHead": head, "OldReq": `message OldReq {}`, "OldRsp": `message OldRsp {}`},
+		"v2.0.0": {"PacketHead": head},
+	}, map[mapper.Protocol]string{"v1.0.0": "OldReq,1\nOldRsp,2\n", "v2.0.0": ""})
+	s := newTestSession(m, nil)
+	s.loginKey = mt19937.NewKeyBlock(7)
+	withSeq := func(seq uint32) []byte {
+		b, err := NewHead(m, "v1.0.0", seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// The unpaired commands are dropped, the sequence ids are tracked anyway.
+	steps := []struct {
+		dir            Direction
+		cmd            uint16
+		head           []byte
+		client, server uint32
+	}{
+		{ClientToServer, 1, withSeq(3), 3, 0},
+		{ServerToClient, 2, withSeq(3), 3, 3},
+		{ClientToServer, 1, withSeq(4), 4, 3},
+		{ServerToClient, 2, nil, 4, 3},
+		{ServerToClient, 2, withSeq(4), 4, 4},
+	}
+	for i, step := range steps {
+		if err := s.ConvertPayload(nil, nil, step.dir, "v1.0.0", "v2.0.0", encodeTestPayload(s, step.cmd, step.head, nil)); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if client, server := s.Sequence(); client != step.client || server != step.server {
+			t.Errorf("step %d: sequence %d %d, want %d %d", i, client, server, step.client, step.server)
+		}
+	}
+}
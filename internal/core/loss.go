@@ -0,0 +1,138 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// Losses counts the source fields dropped by the conversion, per message and
+// version pair, to tell which missing mappings matter in real traffic.
+type Losses struct {
+	mu      sync.Mutex
+	entries map[lossKey]*LossEntry
+}
+
+type lossKey struct {
+	name     string
+	from, to mapper.Protocol
+}
+
+// LossEntry is the number of packets of a message that lost fields, and the
+// number of times each field was lost, dropped as it has no counterpart in
+// the target or unreconciled as its value could not be coerced.
+type LossEntry struct {
+	Message      string            `json:"message"`
+	From         mapper.Protocol   `json:"from"`
+	To           mapper.Protocol   `json:"to"`
+	Packets      uint64            `json:"packets"`
+	Dropped      map[string]uint64 `json:"dropped,omitempty"`
+	Unreconciled map[string]uint64 `json:"unreconciled,omitempty"`
+}
+
+func NewLosses() *Losses {
+	return &Losses{entries: make(map[lossKey]*LossEntry)}
+}
+
+// Add counts the fields dropped and unreconciled from a packet, the fields
+// lost for the first time are logged.
+func (l *Losses) Add(name string, from, to mapper.Protocol, dropped, unreconciled []string) {
+	if len(dropped) == 0 && len(unreconciled) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := lossKey{name, from, to}
+	e := l.entries[key]
+	if e == nil {
+		e = &LossEntry{Message: name, From: from, To: to}
+		l.entries[key] = e
+	}
+	e.Packets++
+	if fresh := countFields(&e.Dropped, dropped); len(fresh) > 0 {
+		logger.Info().Strs("fields", fresh).Msgf("Packet %s drops fields from %s to %s", name, from, to)
+	}
+	if fresh := countFields(&e.Unreconciled, unreconciled); len(fresh) > 0 {
+		logger.Info().Strs("fields", fresh).Msgf("Packet %s cannot coerce fields from %s to %s", name, from, to)
+	}
+}
+
+// countFields counts the fields, and returns those counted for the first
+// time.
+func countFields(counts *map[string]uint64, fields []string) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	if *counts == nil {
+		*counts = make(map[string]uint64)
+	}
+	var fresh []string
+	for _, field := range fields {
+		if (*counts)[field] == 0 {
+			fresh = append(fresh, field)
+		}
+		(*counts)[field]++
+	}
+	return fresh
+}
+
+// Entries returns a copy of the counts, sorted by message and version pair.
+func (l *Losses) Entries() []*LossEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([]*LossEntry, 0, len(l.entries))
+	for _, e := range l.entries {
+		c := *e
+		c.Dropped, c.Unreconciled = copyCounts(e.Dropped), copyCounts(e.Unreconciled)
+		entries = append(entries, &c)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Message != b.Message {
+			return a.Message < b.Message
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return entries
+}
+
+func copyCounts(counts map[string]uint64) map[string]uint64 {
+	if counts == nil {
+		return nil
+	}
+	c := make(map[string]uint64, len(counts))
+	for field, n := range counts {
+		c[field] = n
+	}
+	return c
+}
+
+// Dump writes the counts as JSON to the file, or to the log if no file is
+// given.
+func (l *Losses) Dump(file string) error {
+	entries := l.Entries()
+	if file == "" {
+		for _, e := range entries {
+			logger.Info().Interface("dropped", e.Dropped).Interface("unreconciled", e.Unreconciled).Msgf("Packet %s lost fields %d times from %s to %s", e.Message, e.Packets, e.From, e.To)
+		}
+		logger.Info().Msgf("Dumped %d lossy conversions", len(entries))
+		return nil
+	}
+	p, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, p, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	logger.Info().Msgf("Dumped %d lossy conversions to %s", len(entries), file)
+	return nil
+}
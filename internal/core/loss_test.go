@@ -0,0 +1,66 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLosses(t *testing.T) {
+	l := NewLosses()
+	l.Add("SceneNotify", "v2", "v1", nil, nil)
+	l.Add("SceneNotify", "v2", "v1", []string{"SceneNotify.weather"}, nil)
+	l.Add("SceneNotify", "v2", "v1", []string{"SceneNotify.weather", "SceneNotify.tags"}, []string{"SceneNotify.time"})
+	l.Add("SceneNotify", "v1", "v2", nil, []string{"SceneNotify.time"})
+	l.Add("AvatarNotify", "v2", "v1", []string{"AvatarNotify.skin"}, nil)
+
+	want := []*LossEntry{
+		{Message: "AvatarNotify", From: "v2", To: "v1", Packets: 1, Dropped: map[string]uint64{"AvatarNotify.skin": 1}},
+		{Message: "SceneNotify", From: "v1", To: "v2", Packets: 1, Unreconciled: map[string]uint64{"SceneNotify.time": 1}},
+		{
+			Message: "SceneNotify", From: "v2", To: "v1", Packets: 2,
+			Dropped:      map[string]uint64{"SceneNotify.weather": 2, "SceneNotify.tags": 1},
+			Unreconciled: map[string]uint64{"SceneNotify.time": 1},
+		},
+	}
+	entries := l.Entries()
+	if !reflect.DeepEqual(entries, want) {
+		got, _ := json.Marshal(entries)
+		t.Fatalf("entries %s", got)
+	}
+	// The entries are copies.
+	entries[0].Dropped["AvatarNotify.skin"] = 10
+	if l.Entries()[0].Dropped["AvatarNotify.skin"] != 1 {
+		t.Error("entries share the counts")
+	}
+
+	file := filepath.Join(t.TempDir(), "loss.json")
+	if err := l.Dump(file); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dumped []map[string]any
+	if err := json.Unmarshal(data, &dumped); err != nil {
+		t.Fatal(err)
+	}
+	if len(dumped) != 3 {
+		t.Fatalf("dumped %d entries, want 3", len(dumped))
+	}
+	if _, ok := dumped[0]["unreconciled"]; ok {
+		t.Errorf("dumped unreconciled fields of %v", dumped[0])
+	}
+	if dumped[2]["dropped"] == nil || dumped[2]["unreconciled"] == nil {
+		t.Errorf("dumped %v, want both the dropped and the unreconciled fields", dumped[2])
+	}
+	if err := l.Dump(""); err != nil {
+		t.Errorf("Dump to the log: %v", err)
+	}
+	if err := l.Dump(filepath.Join(t.TempDir(), "missing", "loss.json")); err == nil {
+		t.Error("dumped to a missing directory")
+	}
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"time"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// loginPacket is the packet of the server the notifies follow by default,
+// and the timers start at.
+const loginPacket = "GetPlayerTokenRsp"
+
+// notifyAfter sends the configured notifies following the packet of the
+// server, and starts the timers after the login.
+func (s *Session) notifyAfter(m *mapper.Mapping, name string) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	for _, n := range s.Service.config.Notifies {
+		if n.Every > 0 || !n.Versions.ContainsProtocol(s.protocol) {
+			continue
+		}
+		after := n.After
+		if after == "" {
+			after = loginPacket
+		}
+		if after != name {
+			continue
+		}
+		if n.Once {
+			if s.notified[n] {
+				continue
+			}
+			if s.notified == nil {
+				s.notified = make(map[*config.ConfigNotify]bool)
+			}
+			s.notified[n] = true
+		}
+		s.sendNotify(m, n)
+	}
+	if name != loginPacket || s.notifyTimers {
+		return
+	}
+	s.notifyTimers = true
+	for _, n := range s.Service.config.Notifies {
+		if n.Every > 0 && n.Versions.ContainsProtocol(s.protocol) {
+			go s.notifyEvery(n)
+		}
+	}
+}
+
+// notifyEvery sends the notify on its timer until the session closes, along
+// with the packets sent by the forwarding loops, as the kcp session locks
+// each send.
+func (s *Session) notifyEvery(n *config.ConfigNotify) {
+	t := time.NewTicker(time.Duration(n.Every))
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			s.sendNotify(s.Mapping(), n)
+		}
+	}
+}
+
+func (s *Session) sendNotify(m *mapper.Mapping, n *config.ConfigNotify) {
+	data := []byte(n.Data)
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+	head, err := s.notifyHead(m, s.protocol, true)
+	if err == nil {
+		err = s.SendPacketJSON(s.endpoint, s.protocol, n.Name, head, data)
+	}
+	if err != nil {
+		logger.Warn().Err(err).Msgf("Failed to send notify %s to %s", n.Name, s.protocol)
+	}
+}
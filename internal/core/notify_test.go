@@ -0,0 +1,132 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/crypto/mt19937"
+	"github.com/Jx2f/ViaGenshin/pkg/transport/kcp"
+)
+
+func TestNotifyTriggers(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {"EntityNotify": `message EntityNotify { uint32 entity_id = 1; }`},
+	}, map[mapper.Protocol]string{"v1.0.0": "EntityNotify,10\n"})
+	client, endpoint := dialTestSession(t)
+
+	s := newTestSession(m, nil)
+	s.endpoint = endpoint
+	s.protocol = "v1.0.0"
+	s.loginKey = mt19937.NewKeyBlock(7)
+	later, err := config.ParseVersionRange(">= 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notify := func(id int, n config.ConfigNotify) *config.ConfigNotify {
+		n.Name, n.Data = "EntityNotify", json.RawMessage(fmt.Sprintf(`{"entityId":%d}`, id))
+		return &n
+	}
+	s.Service.config.Notifies = []*config.ConfigNotify{
+		notify(1, config.ConfigNotify{}),
+		notify(2, config.ConfigNotify{After: "PingRsp", Once: true}),
+		notify(3, config.ConfigNotify{After: "PingRsp"}),
+		notify(4, config.ConfigNotify{Every: config.Duration(20 * time.Millisecond)}),
+		notify(5, config.ConfigNotify{Versions: later}),
+	}
+
+	s.notifyAfter(m, "PingRsp")
+	s.notifyAfter(m, loginPacket)
+	s.notifyAfter(m, "PingRsp")
+	s.notifyAfter(m, "PingRsp")
+	// The timers start once.
+	s.notifyAfter(m, loginPacket)
+	time.Sleep(110 * time.Millisecond)
+	close(s.done)
+
+	sent := make(map[uint32]int)
+	for {
+		id, ok := receiveNotify(t, m, s, client)
+		if !ok {
+			break
+		}
+		sent[id]++
+	}
+	if sent[1] != 2 || sent[2] != 1 || sent[3] != 3 || sent[5] != 0 {
+		t.Errorf("sent %v, want 2 of 1, 1 of 2, 3 of 3 and none of 5", sent)
+	}
+	// 5 ticks of 20ms in 110ms, give or take the scheduling.
+	if sent[4] < 3 || sent[4] > 6 {
+		t.Errorf("sent %d of the timed notify, want about 5", sent[4])
+	}
+	time.Sleep(50 * time.Millisecond)
+	if id, ok := receiveNotify(t, m, s, client); ok {
+		t.Errorf("sent %d after the session closed", id)
+	}
+}
+
+// dialTestSession returns a client connected to the endpoint, both closed
+// at the end of the test.
+func dialTestSession(t *testing.T) (client, endpoint *kcp.Session) {
+	t.Helper()
+	l, err := kcp.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	client, err = kcp.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	endpoint, err = l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, endpoint
+}
+
+// receivePacket returns the command, head and data of the next packet the
+// client receives, false if there is none for a while.
+func receivePacket(t *testing.T, s *Session, client *kcp.Session) (uint16, []byte, []byte, bool) {
+	t.Helper()
+	received := make(chan []byte, 1)
+	go func() {
+		if p, err := client.Payload(); err == nil {
+			received <- p
+		}
+	}()
+	var p []byte
+	select {
+	case p = <-received:
+	case <-time.After(100 * time.Millisecond):
+		return 0, nil, nil, false
+	}
+	s.loginKey.Xor(p)
+	n1, n2 := int(binary.BigEndian.Uint16(p[4:6])), int(binary.BigEndian.Uint32(p[6:10]))
+	return binary.BigEndian.Uint16(p[2:4]), p[10 : 10+n1], p[10+n1 : 10+n1+n2], true
+}
+
+// receiveNotify returns the entity id of the next EntityNotify the client
+// receives, false if there is none for a while.
+func receiveNotify(t *testing.T, m *mapper.Mapping, s *Session, client *kcp.Session) (uint32, bool) {
+	t.Helper()
+	cmd, _, data, ok := receivePacket(t, s, client)
+	if !ok {
+		return 0, false
+	}
+	if cmd != 10 {
+		t.Fatalf("received command %d, want EntityNotify", cmd)
+	}
+	msg := dynamic.NewMessage(m.MessageDescMap["v1.0.0"]["EntityNotify"])
+	if err := msg.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	return msg.GetFieldByName("entity_id").(uint32), true
+}
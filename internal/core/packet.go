@@ -1,8 +1,8 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
-	"strings"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/jhump/protoreflect/dynamic"
@@ -20,72 +20,105 @@ var (
 	}
 )
 
-func (s *Session) ConvertPacket(from, to mapper.Protocol, fromCmd uint16, head, p []byte) ([]byte, error) {
-	name := s.mapping.CommandNameMap[from][fromCmd]
-	fromDesc := s.mapping.MessageDescMap[from][name]
-	if fromDesc == nil {
-		return p, fmt.Errorf("unknown from message %s(%d) in %s", name, fromCmd, from)
-	}
-	fromPacket := dynamic.NewMessage(fromDesc)
-	if err := fromPacket.Unmarshal(p); err != nil {
-		return p, err
-	}
-	fromJson, err := fromPacket.MarshalJSONPB(MarshalOptions)
-	if err != nil {
-		return p, err
-	}
-	toJson, err := s.HandlePacket(from, to, name, head, fromJson)
-	if err != nil {
-		if strings.HasPrefix(err.Error(), "injected ") {
-			return p, nil
-		}
-		return p, err
-	}
-	logger.Trace().RawJSON("from", fromJson).RawJSON("to", toJson).Msgf("Packet %s converted from %s to %s", name, from, to)
-	toDesc := s.mapping.MessageDescMap[to][name]
-	if toDesc == nil {
-		return p, fmt.Errorf("unknown to message %s in %s", name, to)
+// MarshalPacketJSON serializes the JSON of the packet in the protocol.
+func MarshalPacketJSON(m *mapper.Mapping, v mapper.Protocol, name string, data []byte) ([]byte, error) {
+	md := m.MessageDescMap[v][name]
+	if md == nil {
+		return nil, fmt.Errorf("unknown message %s in %s", name, v)
 	}
-	toPacket := dynamic.NewMessage(toDesc)
-	if err := toPacket.UnmarshalJSONPB(UnmarshalOptions, toJson); err != nil {
-		return p, err
+	packet := dynamic.NewMessage(md)
+	if err := packet.UnmarshalJSONPB(UnmarshalOptions, data); err != nil {
+		return nil, err
 	}
-	toJson, err = toPacket.MarshalJSONPB(MarshalOptions)
-	if err != nil {
-		return p, err
+	return packet.Marshal()
+}
+
+// ConvertPacket runs the handlers of the packet and converts it, the Data of
+// the result is the serialized packet of to.
+func (s *Session) ConvertPacket(dir Direction, from, to mapper.Protocol, fromCmd uint16, head, p []byte) (*Result, error) {
+	return s.convertCommand(s.Mapping(), dir, from, to, fromCmd, head, p)
+}
+
+func (s *Session) convertCommand(m *mapper.Mapping, dir Direction, from, to mapper.Protocol, fromCmd uint16, head, p []byte) (*Result, error) {
+	name, ok := m.CommandNameMap[from][fromCmd]
+	if !ok {
+		return nil, fmt.Errorf("unknown from message %d in %s", fromCmd, from)
 	}
-	return toPacket.Marshal()
+	return s.convertPacket(m, dir, from, to, name, head, p)
+}
+
+func (s *Session) ConvertPacketByName(dir Direction, from, to mapper.Protocol, name string, p []byte) (*Result, error) {
+	return s.convertPacket(s.Mapping(), dir, from, to, name, nil, p)
 }
 
-func (s *Session) ConvertPacketByName(from, to mapper.Protocol, name string, p []byte) ([]byte, error) {
-	fromDesc := s.mapping.MessageDescMap[from][name]
+// convertPacket converts the packet descriptor to descriptor, the JSON form
+// is only built for the packets with a handler or a rewrite. The rewrites
+// apply to the packet of the client protocol, before the conversion of the
+// packets of the client and after that of the packets of the server.
+func (s *Session) convertPacket(m *mapper.Mapping, dir Direction, from, to mapper.Protocol, name string, head, p []byte) (*Result, error) {
+	handlers := s.Handlers(dir, from, to, name)
+	rewrites := s.rewriteRules(dir, from, to, name)
+	if len(handlers) == 0 && len(rewrites) == 0 && m.SchemaEqual(from, to, name) {
+		return ForwardPacket(p), nil
+	}
+	fromDesc := m.MessageDescMap[from][name]
 	if fromDesc == nil {
-		return p, fmt.Errorf("unknown from message %s in %s", name, from)
+		return nil, fmt.Errorf("unknown from message %s in %s", name, from)
 	}
 	fromPacket := dynamic.NewMessage(fromDesc)
-	if err := fromPacket.Unmarshal(p); err != nil {
-		return p, err
-	}
-	fromJson, err := fromPacket.MarshalJSONPB(MarshalOptions)
+	err := fromPacket.Unmarshal(p)
 	if err != nil {
-		return p, err
+		return nil, err
 	}
-	toJson, err := s.HandlePacket(from, to, name, nil, fromJson)
-	if err != nil {
-		return p, err
+	result := ForwardPacket(nil)
+	if len(handlers) > 0 {
+		fromJson, err := fromPacket.MarshalJSONPB(MarshalOptions)
+		if err != nil {
+			return nil, err
+		}
+		if result, err = s.HandlePacket(handlers, from, to, head, fromJson); err != nil {
+			return nil, err
+		}
+		if result.Action == ActionDrop || result.Action == ActionReplace {
+			logger.Debug().Msgf("Packet %s from %s handled with %s", name, from, result.Action)
+			return result, nil
+		}
+		if !bytes.Equal(fromJson, result.Data) {
+			fromPacket = dynamic.NewMessage(fromDesc)
+			if err := fromPacket.UnmarshalJSONPB(UnmarshalOptions, result.Data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(rewrites) > 0 && dir != ServerToClient {
+		fromPacket = s.rewritePacket(rewrites, from, fromPacket)
 	}
-	logger.Trace().RawJSON("from", fromJson).RawJSON("to", toJson).Msgf("Packet %s converted from %s to %s", name, from, to)
-	toDesc := s.mapping.MessageDescMap[to][name]
+	toDesc := m.MessageDescMap[to][name]
 	if toDesc == nil {
-		return p, fmt.Errorf("unknown to message %s in %s", name, to)
+		return nil, fmt.Errorf("unknown to message %s in %s", name, to)
+	}
+	trace := logger.Trace()
+	var fromJson []byte
+	if trace.Enabled() {
+		fromJson, _ = fromPacket.MarshalJSONPB(MarshalOptions)
+	}
+	c := m.NewConverter(from, to)
+	toPacket := c.Convert(fromPacket, toDesc)
+	if len(rewrites) > 0 && dir == ServerToClient {
+		toPacket = s.rewritePacket(rewrites, to, toPacket)
+	}
+	if fields := c.Unreconciled(); len(fields) > 0 {
+		logger.Debug().Strs("fields", fields).Msgf("Packet %s dropped fields from %s to %s", name, from, to)
 	}
-	toPacket := dynamic.NewMessage(toDesc)
-	if err := toPacket.UnmarshalJSONPB(UnmarshalOptions, toJson); err != nil {
-		return p, err
+	s.losses.Add(name, from, to, c.Dropped(), c.Unreconciled())
+	if trace.Enabled() {
+		toJson, _ := toPacket.MarshalJSONPB(MarshalOptions)
+		trace.RawJSON("from", fromJson).RawJSON("to", toJson).Msgf("Packet %s converted from %s to %s", name, from, to)
 	}
-	toJson, err = toPacket.MarshalJSONPB(MarshalOptions)
+	data, err := toPacket.Marshal()
 	if err != nil {
-		return p, err
+		return nil, err
 	}
-	return toPacket.Marshal()
+	result.Data = data
+	return result, nil
 }
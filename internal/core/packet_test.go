@@ -0,0 +1,53 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+func TestConvertPacketSchemaEqual(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {
+			"SameNotify":    `message SameNotify { uint32 a = 1; uint32 b = 2; }`,
+			"ChangedNotify": `message ChangedNotify { uint32 a = 1; uint32 b = 2; }`,
+		},
+		"v2.0.0": {
+			"SameNotify":    `message SameNotify { uint32 a = 1; uint32 b = 2; }`,
+			"ChangedNotify": `message ChangedNotify { uint32 a = 1; uint64 b = 2; }`,
+		},
+	}, map[mapper.Protocol]string{
+		"v1.0.0": "SameNotify,1\nChangedNotify,2\n",
+		"v2.0.0": "SameNotify,1\nChangedNotify,2\n",
+	})
+	// b = 2 before a = 1, which a conversion writes in field order.
+	in := []byte{0x10, 2, 0x08, 1}
+	converted := []byte{0x08, 1, 0x10, 2}
+	handled := &Handler{Name: "handled", Message: "SameNotify", Handle: func(s *Session, from, to mapper.Protocol, head, data []byte) (*Result, error) {
+		return ForwardPacket(data), nil
+	}}
+	tests := []struct {
+		name     string
+		packet   string
+		handlers map[string][]*Handler
+		want     []byte
+	}{
+		{"same schema", "SameNotify", nil, in},
+		{"changed schema", "ChangedNotify", nil, converted},
+		{"same schema with a handler", "SameNotify", map[string][]*Handler{"SameNotify": {handled}}, converted},
+	}
+	for _, tt := range tests {
+		s := newTestSession(m, tt.handlers)
+		result, err := s.ConvertPacketByName(ServerToClient, "v1.0.0", "v2.0.0", tt.packet, in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Action != ActionForward || !bytes.Equal(result.Data, tt.want) {
+			t.Errorf("%s: got %s %x, want forward %x", tt.name, result.Action, result.Data, tt.want)
+		}
+	}
+	if !m.SchemaEqual("v1.0.0", "v2.0.0", "SameNotify") || m.SchemaEqual("v1.0.0", "v2.0.0", "ChangedNotify") {
+		t.Error("wrong schema equality")
+	}
+}
@@ -0,0 +1,593 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// Rewrites are the compiled rewrites of the config, by message.
+type Rewrites struct {
+	rules map[string][]*rewriteRule
+}
+
+type rewriteRule struct {
+	*config.ConfigRewrite
+	dir   Direction
+	match any
+	merge any
+	patch []*patchOp
+	// warned is set once a skipped rewrite is logged as a warning.
+	warned atomic.Bool
+}
+
+// patchOp is an operation of RFC 6902, with a * in a path for every element
+// of an array or an object, a where predicate on the value at the path, and
+// a clamp operation bounding the number at the path by min and max.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Where json.RawMessage `json:"where,omitempty"`
+	Min   json.Number     `json:"min,omitempty"`
+	Max   json.Number     `json:"max,omitempty"`
+
+	path, from []string
+	value      any
+	where      any
+}
+
+func NewRewrites(configured []*config.ConfigRewrite) (*Rewrites, error) {
+	r := &Rewrites{rules: make(map[string][]*rewriteRule)}
+	for _, c := range configured {
+		rule, err := newRewriteRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite %s: %w", c.Name, err)
+		}
+		r.rules[c.Message] = append(r.rules[c.Message], rule)
+	}
+	return r, nil
+}
+
+func newRewriteRule(c *config.ConfigRewrite) (*rewriteRule, error) {
+	r := &rewriteRule{ConfigRewrite: c}
+	switch c.Direction {
+	case config.RewriteClientToServer:
+		r.dir = ClientToServer
+	case config.RewriteServerToClient:
+		r.dir = ServerToClient
+	}
+	var err error
+	if r.match, err = decodeRaw(c.Match); err != nil {
+		return nil, fmt.Errorf("invalid match: %w", err)
+	}
+	if r.merge, err = decodeRaw(c.Merge); err != nil {
+		return nil, fmt.Errorf("invalid merge: %w", err)
+	}
+	if len(c.Patch) == 0 {
+		return r, nil
+	}
+	if err := json.Unmarshal(c.Patch, &r.patch); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	for i, op := range r.patch {
+		if err := op.compile(); err != nil {
+			return nil, fmt.Errorf("invalid patch operation %d: %w", i, err)
+		}
+	}
+	return r, nil
+}
+
+func (op *patchOp) compile() error {
+	var err error
+	if op.path, err = parsePointer(op.Path); err != nil {
+		return err
+	}
+	if op.value, err = decodeRaw(op.Value); err != nil {
+		return err
+	}
+	if op.where, err = decodeRaw(op.Where); err != nil {
+		return err
+	}
+	switch op.Op {
+	case "add", "move", "copy":
+		if hasWildcard(op.path) {
+			return fmt.Errorf("%s with a * in its path", op.Op)
+		}
+		if op.Op == "add" {
+			break
+		}
+		if op.from, err = parsePointer(op.From); err != nil {
+			return err
+		}
+		if hasWildcard(op.from) {
+			return fmt.Errorf("%s with a * in from", op.Op)
+		}
+	case "remove", "replace", "test":
+	case "clamp":
+		if op.Min == "" && op.Max == "" {
+			return errors.New("clamp without min or max")
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+	if len(op.path) == 0 && op.Op != "test" {
+		return fmt.Errorf("%s of the whole packet", op.Op)
+	}
+	return nil
+}
+
+// find returns the rewrites of the packet, for the client of v.
+func (r *Rewrites) find(dir Direction, v mapper.Protocol, name string) []*rewriteRule {
+	if r == nil {
+		return nil
+	}
+	var found []*rewriteRule
+	for _, rule := range r.rules[name] {
+		if rule.dir != DirectionAny && rule.dir != dir {
+			continue
+		}
+		if !rule.Versions.ContainsProtocol(v) {
+			continue
+		}
+		found = append(found, rule)
+	}
+	return found
+}
+
+// rewriteRules returns the rewrites of the packet for the session.
+func (s *Session) rewriteRules(dir Direction, from, to mapper.Protocol, name string) []*rewriteRule {
+	client := from
+	if dir == ServerToClient {
+		client = to
+	}
+	return s.Service.rewrites.Load().find(dir, client, name)
+}
+
+// rewritePacket applies the rewrites to the packet, a rewrite that does not
+// apply or leaves an invalid packet is skipped.
+func (s *Session) rewritePacket(rules []*rewriteRule, v mapper.Protocol, packet *dynamic.Message) *dynamic.Message {
+	data, err := packet.MarshalJSONPB(MarshalOptions)
+	if err != nil {
+		logger.Warn().Err(err).Msgf("Rewrites of %s of %s skipped", packet.GetMessageDescriptor().GetName(), v)
+		return packet
+	}
+	for _, rule := range rules {
+		rewritten, err := rule.apply(data)
+		if err != nil {
+			rule.skipped(v, err)
+			continue
+		}
+		if rewritten == nil {
+			continue
+		}
+		out := dynamic.NewMessage(packet.GetMessageDescriptor())
+		if err := out.UnmarshalJSONPB(UnmarshalOptions, rewritten); err != nil {
+			logger.Warn().Err(err).Msgf("Rewrite %s left an invalid %s of %s, skipped", rule.Name, rule.Message, v)
+			continue
+		}
+		logger.Debug().RawJSON("from", data).RawJSON("to", rewritten).Msgf("Rewrite %s applied on %s of %s", rule.Name, rule.Message, v)
+		packet, data = out, rewritten
+	}
+	return packet
+}
+
+// skipped logs the rewrite failing on a packet, as a warning the first time
+// and for debugging afterwards.
+func (r *rewriteRule) skipped(v mapper.Protocol, err error) {
+	e := logger.Debug()
+	if r.warned.CompareAndSwap(false, true) {
+		e = logger.Warn()
+	}
+	e.Err(err).Msgf("Rewrite %s skipped on %s of %s", r.Name, r.Message, v)
+}
+
+// apply returns the rewritten JSON, nil if the packet does not match.
+func (r *rewriteRule) apply(data []byte) ([]byte, error) {
+	obj, err := decodeObject(data)
+	if err != nil {
+		return nil, err
+	}
+	if r.match != nil && !matchJSON(r.match, obj) {
+		return nil, nil
+	}
+	var doc any = obj
+	if r.merge != nil {
+		doc = mergePatch(doc, r.merge)
+	}
+	for _, op := range r.patch {
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("failed to %s %s: %w", op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func (op *patchOp) apply(doc any) (any, error) {
+	switch op.Op {
+	case "add":
+		return patchAt(doc, op.path, addValue(copyJSON(op.value)))
+	case "move", "copy":
+		value, ok := getPath(doc, op.from)
+		if !ok {
+			return nil, fmt.Errorf("no value at %s", op.From)
+		}
+		var err error
+		if op.Op == "move" {
+			if doc, err = patchAt(doc, op.from, removeValue); err != nil {
+				return nil, err
+			}
+		} else {
+			value = copyJSON(value)
+		}
+		return patchAt(doc, op.path, addValue(value))
+	}
+	paths := expandPath(doc, op.path, nil, nil)
+	if len(paths) == 0 && !hasWildcard(op.path) {
+		return nil, errors.New("no value")
+	}
+	// The last paths first, so that removing an element keeps the indexes
+	// of the others.
+	for i := len(paths) - 1; i >= 0; i-- {
+		path := paths[i]
+		value, ok := getPath(doc, path)
+		if !ok {
+			if hasWildcard(op.path) {
+				continue
+			}
+			return nil, errors.New("no value")
+		}
+		if op.where != nil && !matchJSON(op.where, value) {
+			continue
+		}
+		var err error
+		switch op.Op {
+		case "remove":
+			doc, err = patchAt(doc, path, removeValue)
+		case "replace":
+			doc, err = patchAt(doc, path, replaceValue(copyJSON(op.value)))
+		case "test":
+			if !matchJSON(op.value, value) || !matchJSON(value, op.value) {
+				err = errors.New("test failed")
+			}
+		case "clamp":
+			doc, err = patchAt(doc, path, replaceValue(op.clamp(value)))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func (op *patchOp) clamp(value any) any {
+	f, ok := toNumber(value)
+	if !ok {
+		return value
+	}
+	bound := json.Number("")
+	if min, ok := toNumber(op.Min); ok && f < min {
+		bound = op.Min
+	}
+	if max, ok := toNumber(op.Max); ok && f > max {
+		bound = op.Max
+	}
+	if bound == "" {
+		return value
+	}
+	// The int64 and uint64 fields are strings in JSON.
+	if _, ok := value.(string); ok {
+		return string(bound)
+	}
+	return bound
+}
+
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid path %q", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func hasWildcard(path []string) bool {
+	for _, t := range path {
+		if t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPath returns the paths matching path in v, the * replaced with every
+// index or key. The last token is kept as it is if it is not a *.
+func expandPath(v any, path, prefix []string, out [][]string) [][]string {
+	if len(path) == 0 {
+		return append(out, prefix)
+	}
+	t := path[0]
+	next := func(token string) []string {
+		return append(prefix[:len(prefix):len(prefix)], token)
+	}
+	if t != "*" {
+		if len(path) == 1 {
+			return append(out, next(t))
+		}
+		child, ok := getChild(v, t)
+		if !ok {
+			return out
+		}
+		return expandPath(child, path[1:], next(t), out)
+	}
+	switch c := v.(type) {
+	case []any:
+		for i, child := range c {
+			out = expandPath(child, path[1:], next(strconv.Itoa(i)), out)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			out = expandPath(c[k], path[1:], next(k), out)
+		}
+	}
+	return out
+}
+
+func getChild(v any, token string) (any, bool) {
+	switch c := v.(type) {
+	case map[string]any:
+		child, ok := c[token]
+		return child, ok
+	case []any:
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(c) {
+			return nil, false
+		}
+		return c[i], true
+	}
+	return nil, false
+}
+
+func getPath(v any, path []string) (any, bool) {
+	for _, t := range path {
+		var ok bool
+		if v, ok = getChild(v, t); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// patchAt returns v with the container of the last token of path replaced by
+// the result of f.
+func patchAt(v any, path []string, f func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return f(v, path[0])
+	}
+	child, ok := getChild(v, path[0])
+	if !ok {
+		return nil, fmt.Errorf("no value at %s", path[0])
+	}
+	child, err := patchAt(child, path[1:], f)
+	if err != nil {
+		return nil, err
+	}
+	return replaceValue(child)(v, path[0])
+}
+
+func arrayIndex(c []any, token string, end bool) (int, error) {
+	if end && token == "-" {
+		return len(c), nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > len(c) || !end && i == len(c) {
+		return 0, fmt.Errorf("invalid index %s", token)
+	}
+	return i, nil
+}
+
+func addValue(value any) func(any, string) (any, error) {
+	return func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			i, err := arrayIndex(c, token, true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("no object or array at %s", token)
+	}
+}
+
+func replaceValue(value any) func(any, string) (any, error) {
+	return func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("no value at %s", token)
+			}
+			c[token] = value
+			return c, nil
+		case []any:
+			i, err := arrayIndex(c, token, false)
+			if err != nil {
+				return nil, err
+			}
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("no object or array at %s", token)
+	}
+}
+
+func removeValue(container any, token string) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		if _, ok := c[token]; !ok {
+			return nil, fmt.Errorf("no value at %s", token)
+		}
+		delete(c, token)
+		return c, nil
+	case []any:
+		i, err := arrayIndex(c, token, false)
+		if err != nil {
+			return nil, err
+		}
+		return append(c[:i], c[i+1:]...), nil
+	}
+	return nil, fmt.Errorf("no object or array at %s", token)
+}
+
+// mergePatch applies the merge patch of RFC 7396.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return copyJSON(patch)
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// matchJSON tells if the value holds the pattern: the fields of an object
+// pattern match, the elements of an array pattern match one by one, and the
+// scalars are equal. An unset field is its zero value, and the numbers
+// written as strings are numbers.
+func matchJSON(pattern, value any) bool {
+	switch p := pattern.(type) {
+	case map[string]any:
+		v, _ := value.(map[string]any)
+		if v == nil && value != nil {
+			return false
+		}
+		for k, pv := range p {
+			if !matchJSON(pv, v[k]) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		v, _ := value.([]any)
+		if len(p) != len(v) {
+			return false
+		}
+		for i := range p {
+			if !matchJSON(p[i], v[i]) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return value == nil
+	case bool:
+		v, ok := value.(bool)
+		return (ok || value == nil) && v == p
+	case string:
+		if value == nil {
+			return p == ""
+		}
+		v, ok := value.(string)
+		if ok && v == p {
+			return true
+		}
+		return matchNumber(p, value)
+	case json.Number:
+		if value == nil {
+			f, _ := toNumber(p)
+			return f == 0
+		}
+		return matchNumber(p, value)
+	}
+	return false
+}
+
+func matchNumber(a, b any) bool {
+	x, ok := toNumber(a)
+	if !ok {
+		return false
+	}
+	y, ok := toNumber(b)
+	return ok && x == y
+}
+
+func toNumber(v any) (float64, bool) {
+	var s string
+	switch v := v.(type) {
+	case json.Number:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+func decodeRaw(data json.RawMessage) (any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	d := json.NewDecoder(strings.NewReader(string(data)))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func copyJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = copyJSON(e)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = copyJSON(e)
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+func TestRewriteApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		merge string
+		patch string
+		in    string
+		want  string
+	}{
+		{
+			"remove under * in reverse order",
+			"",
+			`[{"op": "remove", "path": "/list/*", "where": {"id": 1}}]`,
+			`{"list": [{"id": 1}, {"id": 1}, {"id": 2}, {"id": 1}, {"id": 3}]}`,
+			`{"list": [{"id": 2}, {"id": 3}]}`,
+		},
+		{
+			"remove every value of an object",
+			"",
+			`[{"op": "remove", "path": "/map/*", "where": 0}]`,
+			`{"map": {"a": 0, "b": 1, "c": 0}}`,
+			`{"map": {"b": 1}}`,
+		},
+		{
+			"move forward in the same array",
+			"",
+			`[{"op": "move", "from": "/list/0", "path": "/list/2"}]`,
+			`{"list": ["a", "b", "c"]}`,
+			`{"list": ["b", "c", "a"]}`,
+		},
+		{
+			"move backward in the same array",
+			"",
+			`[{"op": "move", "from": "/list/2", "path": "/list/0"}]`,
+			`{"list": ["a", "b", "c"]}`,
+			`{"list": ["c", "a", "b"]}`,
+		},
+		{
+			"add with -",
+			"",
+			`[{"op": "add", "path": "/list/-", "value": 4}, {"op": "add", "path": "/list/0", "value": 0}]`,
+			`{"list": [1, 2]}`,
+			`{"list": [0, 1, 2, 4]}`,
+		},
+		{
+			"copy",
+			"",
+			`[{"op": "copy", "from": "/a", "path": "/b"}, {"op": "replace", "path": "/a/x", "value": 2}]`,
+			`{"a": {"x": 1}}`,
+			`{"a": {"x": 2}, "b": {"x": 1}}`,
+		},
+		{
+			"test passing",
+			"",
+			`[{"op": "test", "path": "/level", "value": 90}, {"op": "replace", "path": "/level", "value": 80}]`,
+			`{"level": 90}`,
+			`{"level": 80}`,
+		},
+		{
+			"clamp numbers and int64 strings",
+			"",
+			`[{"op": "clamp", "path": "/small", "min": 10}, {"op": "clamp", "path": "/big", "max": 100},
+			  {"op": "clamp", "path": "/list/*", "min": 0, "max": 5}]`,
+			`{"small": 5, "big": "12345678901234", "list": [-1, 3, "9"]}`,
+			`{"small": 10, "big": "100", "list": [0, 3, "5"]}`,
+		},
+		{
+			"merge then patch",
+			`{"a": null, "b": {"c": 1}}`,
+			`[{"op": "add", "path": "/b/d", "value": 2}]`,
+			`{"a": 1, "b": {"e": 3}}`,
+			`{"b": {"c": 1, "d": 2, "e": 3}}`,
+		},
+	}
+	for _, tt := range tests {
+		rule := newTestRewrite(t, "", tt.merge, tt.patch)
+		got, err := rule.apply([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !equalJSON(t, got, []byte(tt.want)) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		in    string
+	}{
+		{"test failing", `[{"op": "test", "path": "/level", "value": 80}]`, `{"level": 90}`},
+		{"test on a missing value", `[{"op": "test", "path": "/level", "value": 80}]`, `{}`},
+		{"remove of a missing value", `[{"op": "remove", "path": "/level"}]`, `{}`},
+		{"replace past the end", `[{"op": "replace", "path": "/list/2", "value": 0}]`, `{"list": [1, 2]}`},
+		{"move of a missing value", `[{"op": "move", "from": "/a", "path": "/b"}]`, `{}`},
+	}
+	for _, tt := range tests {
+		if got, err := newTestRewrite(t, "", "", tt.patch).apply([]byte(tt.in)); err == nil {
+			t.Errorf("%s: got %s, want an error", tt.name, got)
+		}
+	}
+	// A * matching nothing is not an error.
+	rule := newTestRewrite(t, "", "", `[{"op": "remove", "path": "/list/*/x"}]`)
+	if _, err := rule.apply([]byte(`{"list": []}`)); err != nil {
+		t.Errorf("remove under * of nothing: %v", err)
+	}
+	// Nor is a packet not matching.
+	rule = newTestRewrite(t, `{"level": 1}`, "", `[{"op": "remove", "path": "/missing"}]`)
+	if got, err := rule.apply([]byte(`{"level": 2}`)); got != nil || err != nil {
+		t.Errorf("apply on a packet not matching = %s, %v, want nil", got, err)
+	}
+}
+
+func TestRewritePacketSkipsFailingRules(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {"LevelNotify": `message LevelNotify { uint32 level = 1; uint64 exp = 2; }`},
+	}, map[mapper.Protocol]string{"v1.0.0": "LevelNotify,1\n"})
+	s := newTestSession(m, nil)
+	failing := newTestRewrite(t, "", "", `[{"op": "replace", "path": "/level", "value": 1}, {"op": "test", "path": "/level", "value": 2}]`)
+	invalid := newTestRewrite(t, "", "", `[{"op": "replace", "path": "/level", "value": "high"}]`)
+	passing := newTestRewrite(t, "", "", `[{"op": "clamp", "path": "/exp", "max": 1000}]`)
+	packet := dynamic.NewMessage(m.MessageDescMap["v1.0.0"]["LevelNotify"])
+	packet.SetFieldByName("level", uint32(90))
+	packet.SetFieldByName("exp", uint64(5000))
+
+	for i := 0; i < 2; i++ {
+		out := s.rewritePacket([]*rewriteRule{failing, invalid, passing}, "v1.0.0", packet)
+		if level, exp := out.GetFieldByName("level"), out.GetFieldByName("exp"); level != uint32(90) || exp != uint64(1000) {
+			t.Errorf("rewritten to level %v and exp %v, want 90 and 1000", level, exp)
+		}
+	}
+	if !failing.warned.Load() || passing.warned.Load() {
+		t.Errorf("warned %t and %t, want only the failing rewrite", failing.warned.Load(), passing.warned.Load())
+	}
+	if packet.GetFieldByName("exp") != uint64(5000) {
+		t.Error("rewritten the packet in place")
+	}
+}
+
+func TestMatchJSON(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{`{"a": 1}`, `{"a": 1, "b": 2}`, true},
+		{`{"a": 1}`, `{"a": 2}`, false},
+		{`{"a": {"b": true}}`, `{"a": {"b": true, "c": 1}}`, true},
+		// An unset field is its zero value.
+		{`{"a": 0}`, `{}`, true},
+		{`{"a": 0.0}`, `{}`, true},
+		{`{"a": ""}`, `{}`, true},
+		{`{"a": false}`, `{}`, true},
+		{`{"a": {}}`, `{}`, true},
+		{`{"a": []}`, `{}`, true},
+		{`{"a": {"b": 0}}`, `{}`, true},
+		{`{"a": 1}`, `{}`, false},
+		{`{"a": "x"}`, `{}`, false},
+		{`{"a": true}`, `{}`, false},
+		{`{"a": [0]}`, `{}`, false},
+		{`{"a": null}`, `{}`, true},
+		{`{"a": null}`, `{"a": 0}`, false},
+		// The numbers written as strings are numbers.
+		{`{"a": 5}`, `{"a": "5"}`, true},
+		{`{"a": "5"}`, `{"a": 5.0}`, true},
+		{`{"a": "12345678901234"}`, `{"a": "12345678901234"}`, true},
+		{`{"a": "x"}`, `{"a": 5}`, false},
+		{`{"a": [1, 2]}`, `{"a": [1, 2]}`, true},
+		{`{"a": [1, 2]}`, `{"a": [1, 2, 3]}`, false},
+		{`{"a": [{"b": 1}]}`, `{"a": [{"b": 1, "c": 2}]}`, true},
+		{`{"a": {}}`, `{"a": 1}`, false},
+		{`true`, `false`, false},
+	}
+	for _, tt := range tests {
+		pattern, err := decodeRaw(json.RawMessage(tt.pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := decodeRaw(json.RawMessage(tt.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := matchJSON(pattern, value); got != tt.want {
+			t.Errorf("matchJSON(%s, %s) = %t, want %t", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNewRewritesInvalid(t *testing.T) {
+	for _, patch := range []string{
+		`[{"op": "swap", "path": "/a"}]`,
+		`[{"op": "add", "path": "/list/*", "value": 1}]`,
+		`[{"op": "move", "from": "/list/*", "path": "/a"}]`,
+		`[{"op": "remove", "path": "a"}]`,
+		`[{"op": "remove", "path": ""}]`,
+		`[{"op": "clamp", "path": "/a"}]`,
+		`{"op": "remove"}`,
+	} {
+		c := &config.ConfigRewrite{Name: "invalid", Message: "LevelNotify", Patch: json.RawMessage(patch)}
+		if _, err := NewRewrites([]*config.ConfigRewrite{c}); err == nil {
+			t.Errorf("NewRewrites(%s) succeeded, want an error", patch)
+		}
+	}
+}
+
+func newTestRewrite(t *testing.T, match, merge, patch string) *rewriteRule {
+	t.Helper()
+	c := &config.ConfigRewrite{Name: "test", Message: "LevelNotify"}
+	if match != "" {
+		c.Match = json.RawMessage(match)
+	}
+	if merge != "" {
+		c.Merge = json.RawMessage(merge)
+	}
+	if patch != "" {
+		c.Patch = json.RawMessage(patch)
+	}
+	rule, err := newRewriteRule(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func equalJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	x, err := decodeRaw(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := decodeRaw(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(x, y)
+}
@@ -7,8 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
-
-	"github.com/jhump/protoreflect/dynamic"
+	"sync/atomic"
 
 	"github.com/Jx2f/ViaGenshin/internal/config"
 	"github.com/Jx2f/ViaGenshin/internal/mapper"
@@ -82,11 +81,22 @@ type Session struct {
 	loginKey  *mt19937.KeyBlock
 	playerUid uint32
 
+	// clientSeq is the last client sequence id sent by the client, serverSeq
+	// the last one answered by the server.
+	clientSeq atomic.Uint32
+	serverSeq atomic.Uint32
+
+	// done is closed when the session stops forwarding.
+	done         chan struct{}
+	notifyMu     sync.Mutex
+	notified     map[*config.ConfigNotify]bool
+	notifyTimers bool
+
 	Engine
 }
 
 func newSession(s *Server, endpoint *kcp.Session) *Session {
-	return &Session{Server: s, endpoint: endpoint}
+	return &Session{Server: s, endpoint: endpoint, done: make(chan struct{})}
 }
 
 func (s *Session) Start() error {
@@ -100,10 +110,13 @@ func (s *Session) Start() error {
 }
 
 func (s *Session) Forward() error {
+	defer close(s.done)
 	wg := new(sync.WaitGroup)
-	wg.Add(1)
+	wg.Add(2)
+	// Either side closing closes the other, so both loops end.
 	go func() {
 		defer wg.Done()
+		defer s.upstream.Close()
 		for {
 			payload, err := s.endpoint.Payload()
 			if err != nil {
@@ -111,7 +124,7 @@ func (s *Session) Forward() error {
 				return
 			}
 			if err := s.ConvertPayload(
-				s.endpoint, s.upstream, s.protocol, s.config.MainProtocol, payload,
+				s.endpoint, s.upstream, ClientToServer, s.protocol, s.config.MainProtocol, payload,
 			); err != nil {
 				logger.Warn().Err(err).Msg("Failed to convert endpoint payload")
 			}
@@ -120,6 +133,7 @@ func (s *Session) Forward() error {
 	}()
 	go func() {
 		defer wg.Done()
+		defer s.endpoint.Close()
 		for {
 			payload, err := s.upstream.Payload()
 			if err != nil {
@@ -127,7 +141,7 @@ func (s *Session) Forward() error {
 				return
 			}
 			if err := s.ConvertPayload(
-				s.upstream, s.endpoint, s.config.MainProtocol, s.protocol, payload,
+				s.upstream, s.endpoint, ServerToClient, s.config.MainProtocol, s.protocol, payload,
 			); err != nil {
 				logger.Warn().Err(err).Msg("Failed to convert upstream payload")
 			}
@@ -139,7 +153,7 @@ func (s *Session) Forward() error {
 }
 
 func (s *Session) ConvertPayload(
-	fromSession, toSession *kcp.Session,
+	fromSession, toSession *kcp.Session, dir Direction,
 	from, to mapper.Protocol, payload transport.Payload,
 ) error {
 	n := len(payload)
@@ -161,15 +175,70 @@ func (s *Session) ConvertPayload(
 	}
 	head := b.Next(int(n1))
 	fromData := b.Next(int(n2))
-	toCmd := fromCmd
+	m := s.Mapping()
+	if seq := ClientSequenceID(m, from, head); seq != 0 {
+		if dir == ClientToServer {
+			s.clientSeq.Store(seq)
+		} else {
+			s.serverSeq.Store(seq)
+		}
+	}
+	toCmd, ok := fromCmd, true
 	if from != to {
-		toCmd = s.mapping.CommandPairMap[from][to][fromCmd]
+		toCmd, ok = m.CommandPairMap[from][to][fromCmd]
 	}
-	toData, err := s.ConvertPacket(from, to, fromCmd, head, fromData)
+	if !ok {
+		result, err := s.handleUnpaired(m, dir, from, to, fromCmd, head, fromData)
+		if err != nil {
+			return err
+		}
+		if result == nil {
+			return s.unknownCommand(m, fromSession, toSession, dir, from, to, fromCmd, head, fromData)
+		}
+		return s.SendResult(fromSession, toSession, from, to, 0, head, result)
+	}
+	result, err := s.convertCommand(m, dir, from, to, fromCmd, head, fromData)
 	if err != nil {
 		return err
 	}
-	return s.SendPacket(toSession, to, toCmd, head, toData)
+	if err := s.SendResult(fromSession, toSession, from, to, toCmd, head, result); err != nil {
+		return err
+	}
+	if dir == ServerToClient {
+		s.notifyAfter(m, m.CommandNameMap[from][fromCmd])
+	}
+	return nil
+}
+
+// Sequence returns the last client sequence id sent by the client, and the
+// last one answered by the server.
+func (s *Session) Sequence() (client, server uint32) {
+	return s.clientSeq.Load(), s.serverSeq.Load()
+}
+
+// SendResult sends the converted packet as the result tells, and the packets
+// of the result, the replies back to fromSession in from.
+func (s *Session) SendResult(fromSession, toSession *kcp.Session, from, to mapper.Protocol, toCmd uint16, head []byte, result *Result) error {
+	if result.Action == ActionForward || result.Action == ActionInject {
+		if err := s.SendPacket(toSession, to, toCmd, head, result.Data); err != nil {
+			return err
+		}
+	}
+	m := s.Mapping()
+	for _, p := range result.Packets {
+		session, protocol := toSession, to
+		if p.Reply {
+			session, protocol = fromSession, from
+		}
+		pHead, err := s.injectedHead(m, from, protocol, p, head, session == s.endpoint)
+		if err != nil {
+			return fmt.Errorf("failed to build the head of %s: %w", p.Name, err)
+		}
+		if err := s.SendPacketJSON(session, protocol, p.Name, pHead, p.Data); err != nil {
+			return fmt.Errorf("failed to send %s: %w", p.Name, err)
+		}
+	}
+	return nil
 }
 
 func (s *Session) EncryptPayload(payload transport.Payload, first bool) error {
@@ -201,7 +270,7 @@ func (s *Session) SendPacket(toSession *kcp.Session, to mapper.Protocol, toCmd u
 	b.Write(toData)
 	b.Write([]byte{0x89, 0xAB})
 	payload := b.Bytes()
-	name := s.mapping.CommandNameMap[to][toCmd]
+	name := s.Mapping().CommandNameMap[to][toCmd]
 	if err := s.EncryptPayload(payload, name == "GetPlayerTokenReq" || name == "GetPlayerTokenRsp"); err != nil {
 		return err
 	}
@@ -209,28 +278,12 @@ func (s *Session) SendPacket(toSession *kcp.Session, to mapper.Protocol, toCmd u
 }
 
 func (s *Session) SendPacketJSON(toSession *kcp.Session, to mapper.Protocol, name string, toHead, data []byte) error {
-	toCmd := s.mapping.BaseCommands[name]
-	if s.mapping.BaseProtocol != to {
-		if toCmd == 0 {
-			for k, v := range s.mapping.CommandNameMap[to] {
-				if v == name {
-					toCmd = k
-					break
-				}
-			}
-		} else {
-			toCmd = s.mapping.CommandPairMap[s.mapping.BaseProtocol][to][toCmd]
-		}
-	}
-	toDesc := s.mapping.MessageDescMap[to][name]
-	if toDesc == nil {
-		return fmt.Errorf("unknown to message %s in %s", name, to)
-	}
-	toPacket := dynamic.NewMessage(toDesc)
-	if err := toPacket.UnmarshalJSONPB(UnmarshalOptions, data); err != nil {
-		return err
+	m := s.Mapping()
+	toCmd, ok := m.CommandIDMap[to][name]
+	if !ok {
+		return fmt.Errorf("unknown command %s in %s", name, to)
 	}
-	toData, err := toPacket.Marshal()
+	toData, err := MarshalPacketJSON(m, to, name, data)
 	if err != nil {
 		return err
 	}
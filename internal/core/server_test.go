@@ -0,0 +1,40 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+func TestForwardStops(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {"PingReq": `message PingReq { uint32 seq = 1; }`},
+	}, map[mapper.Protocol]string{"v1.0.0": "PingReq,1\n"})
+	for _, side := range []string{"client", "server"} {
+		client, endpoint := dialTestSession(t)
+		upstream, server := dialTestSession(t)
+		s := newTestSession(m, nil)
+		s.endpoint, s.upstream = endpoint, upstream
+		forwarded := make(chan error, 1)
+		go func() { forwarded <- s.Forward() }()
+		if side == "client" {
+			client.Close()
+		} else {
+			server.Close()
+		}
+		select {
+		case err := <-forwarded:
+			if err != nil {
+				t.Errorf("%s closed: %v", side, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s closed: still forwarding", side)
+		}
+		select {
+		case <-s.done:
+		default:
+			t.Errorf("%s closed: session not done", side)
+		}
+	}
+}
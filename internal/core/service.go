@@ -1,19 +1,35 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/Jx2f/ViaGenshin/internal/config"
 	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
 )
 
 type Service struct {
 	config *config.Config
 
-	keys    *Keys
-	mapping *mapper.Mapping
+	keys      *Keys
+	mapping   atomic.Pointer[mapper.Mapping]
+	reloading sync.Mutex
+	losses    *Losses
+
+	// substitutions are the handlers of the configured substitutions.
+	substitutions map[string][]*Handler
+	// rewrites are swapped on reload like the mapping.
+	rewrites atomic.Pointer[Rewrites]
+	// The digests of the loaded mapping and rewrites, those unchanged are
+	// not loaded again on reload.
+	mappingDigest  string
+	rewritesDigest []byte
 
 	mu      sync.RWMutex
 	servers map[config.Protocol]*Server
@@ -27,6 +43,7 @@ func NewService(c *config.Config) *Service {
 	s := new(Service)
 	s.config = c
 	s.servers = make(map[config.Protocol]*Server)
+	s.losses = NewLosses()
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
 	s.stopping = sync.WaitGroup{}
 	return s
@@ -38,17 +55,28 @@ func (s *Service) Start() error {
 	if err != nil {
 		return err
 	}
-	s.mapping, err = mapper.NewMappingFromConfig(s.config.Protocols)
+	s.substitutions, err = newSubstitutionHandlers(s.config.Substitutions)
+	if err != nil {
+		return err
+	}
+	if err := s.ReloadRewrites(); err != nil {
+		return err
+	}
+	if s.mappingDigest, err = mapper.SourceDigest(s.config.Protocols); err != nil {
+		return err
+	}
+	mapping, err := mapper.NewMappingFromConfig(s.config.Protocols)
 	if err != nil {
 		return err
 	}
+	s.mapping.Store(mapping)
 	for v := range s.config.Endpoints.Mapping {
 		server, err := NewServer(s, s.config.Endpoints, v)
 		if err != nil {
 			return err
 		}
+		s.stopping.Add(1)
 		go func() {
-			s.stopping.Add(1)
 			if err2 := server.Start(s.ctx); err2 != nil {
 				err = errors.Join(err, err2)
 			}
@@ -64,5 +92,84 @@ func (s *Service) Start() error {
 
 func (s *Service) Stop() error {
 	s.ctxCancel()
+	if s.config.LossFile != "" {
+		return s.DumpLosses()
+	}
 	return nil
 }
+
+// Mapping returns the mapping in use, a packet should be converted with the
+// same mapping from start to end.
+func (s *Service) Mapping() *mapper.Mapping {
+	return s.mapping.Load()
+}
+
+// Reload reloads the rewrites and the mapping if they changed, those in use
+// are kept if the new ones fail to load.
+func (s *Service) Reload() error {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	return errors.Join(s.ReloadRewrites(), s.reloadMapping())
+}
+
+// ReloadRewrites reads the rewrites of the config again and swaps them in for
+// the next packets if they changed.
+func (s *Service) ReloadRewrites() error {
+	configured, err := s.config.LoadRewrites()
+	if err != nil {
+		return fmt.Errorf("failed to reload rewrites: %w", err)
+	}
+	digest, err := json.Marshal(configured)
+	if err != nil {
+		return fmt.Errorf("failed to reload rewrites: %w", err)
+	}
+	if s.rewritesDigest != nil && bytes.Equal(digest, s.rewritesDigest) {
+		logger.Info().Msg("Rewrites unchanged")
+		return nil
+	}
+	rewrites, err := NewRewrites(configured)
+	if err != nil {
+		return fmt.Errorf("failed to reload rewrites: %w", err)
+	}
+	s.rewrites.Store(rewrites)
+	s.rewritesDigest = digest
+	logger.Info().Msgf("Loaded %d rewrites", len(configured))
+	return nil
+}
+
+// reloadMapping rebuilds the mapping from the protocol files and swaps it in
+// for the next packets, if the files changed.
+func (s *Service) reloadMapping() error {
+	digest, err := mapper.SourceDigest(s.config.Protocols)
+	if err != nil {
+		return fmt.Errorf("failed to reload mappings: %w", err)
+	}
+	if digest == s.mappingDigest {
+		logger.Info().Msg("Protocol files unchanged")
+		return nil
+	}
+	logger.Info().Msg("Reloading protocol mappings")
+	mapping, err := mapper.NewMappingFromConfig(s.config.Protocols)
+	if err != nil {
+		return fmt.Errorf("failed to reload mappings: %w", err)
+	}
+	protocols := []config.Protocol{s.config.Endpoints.MainProtocol}
+	for v := range s.config.Endpoints.Mapping {
+		protocols = append(protocols, v)
+	}
+	for _, v := range protocols {
+		if len(mapping.CommandIDMap[v]) == 0 {
+			return fmt.Errorf("failed to reload mappings: no command loaded in %s", v)
+		}
+	}
+	s.mapping.Store(mapping)
+	s.mappingDigest = digest
+	logger.Info().Msg("Reloaded protocol mappings")
+	return nil
+}
+
+// DumpLosses writes the fields dropped by the conversion so far to the loss
+// file, or to the log.
+func (s *Service) DumpLosses() error {
+	return s.losses.Dump(s.config.LossFile)
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+func TestServiceReload(t *testing.T) {
+	messages := map[mapper.Protocol]map[string]string{
+		"v1.0.0": {"PingReq": `message PingReq { uint32 seq = 1; }`},
+		"v2.0.0": {"PingReq": `message PingReq { uint32 seq = 1; }`},
+	}
+	commands := map[mapper.Protocol]string{"v1.0.0": "PingReq,1\n", "v2.0.0": "PingReq,2\n"}
+	protocols := newTestProtocols(t, "v1.0.0", messages, commands)
+	rewrite := func(value int) *config.ConfigRewrite {
+		return &config.ConfigRewrite{Name: "seq", Message: "PingReq", Merge: json.RawMessage(fmt.Sprintf(`{"seq": %d}`, value))}
+	}
+	c := &config.Config{
+		Protocols: protocols,
+		Endpoints: &config.ConfigEndpoints{MainProtocol: "v1.0.0", Mapping: map[config.Protocol]string{"v2.0.0": ":0"}},
+		Rewrites:  []*config.ConfigRewrite{rewrite(1)},
+	}
+	s := NewService(c)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	m, r := s.Mapping(), s.rewrites.Load()
+	if m == nil || r == nil {
+		t.Fatal("nothing loaded")
+	}
+
+	// Nothing changed.
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Mapping() != m || s.rewrites.Load() != r {
+		t.Error("reloaded the unchanged mapping or rewrites")
+	}
+
+	// The rewrites changed.
+	c.Rewrites = []*config.ConfigRewrite{rewrite(2)}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Mapping() != m || s.rewrites.Load() == r {
+		t.Error("the rewrites changed, want only them reloaded")
+	}
+	r = s.rewrites.Load()
+
+	// A protocol changed.
+	messages["v2.0.0"]["PingReq"] = `message PingReq { uint32 seq = 1; uint64 time = 2; }`
+	writeTestProtocol(t, protocols.Mapping["v2.0.0"], messages["v2.0.0"], commands["v2.0.0"])
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Mapping() == m || s.rewrites.Load() != r {
+		t.Error("the protocol changed, want only the mapping reloaded")
+	}
+	if s.Mapping().MessageDescMap["v2.0.0"]["PingReq"].FindFieldByName("time") == nil {
+		t.Error("the reloaded mapping misses the new field")
+	}
+	m = s.Mapping()
+
+	// A protocol of the endpoints lost its commands, and a rewrite is invalid.
+	writeTestProtocol(t, protocols.Mapping["v2.0.0"], messages["v2.0.0"], "")
+	c.Rewrites = []*config.ConfigRewrite{{Name: "invalid", Message: "PingReq", Patch: json.RawMessage(`[{"op": "swap", "path": "/seq"}]`)}}
+	if err := s.Reload(); err == nil {
+		t.Error("reloaded an invalid mapping and rewrites")
+	}
+	if s.Mapping() != m || s.rewrites.Load() != r {
+		t.Error("replaced the mapping or the rewrites in use with invalid ones")
+	}
+	if err := os.RemoveAll(filepath.Join(protocols.Mapping["v1.0.0"], "protocol")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.reloadMapping(); err == nil || s.Mapping() != m {
+		t.Errorf("reloaded a mapping without the base protocol: %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// maxSubstituted is the number of substituted requests a session remembers
+// while waiting for their responses.
+const maxSubstituted = 64
+
+// substitution is a compiled substitution rule, run by a handler of the
+// request of the client and a handler of the response of the server.
+type substitution struct {
+	*config.ConfigSubstitution
+	requestFields  []*fieldExpression
+	responseFields []*fieldExpression
+}
+
+type fieldExpression struct {
+	path []string
+	expr *expression
+}
+
+// RegisterSubstitution adds the handlers of the substitution, it is meant to
+// be called from init.
+func RegisterSubstitution(c *config.ConfigSubstitution) {
+	r, err := newSubstitution(c)
+	if err != nil {
+		panic(err)
+	}
+	for _, h := range r.handlers() {
+		RegisterHandler(h)
+	}
+}
+
+// newSubstitutionHandlers compiles the configured substitutions into their
+// handlers by message.
+func newSubstitutionHandlers(substitutions []*config.ConfigSubstitution) (map[string][]*Handler, error) {
+	configured := make(map[string][]*Handler)
+	for _, c := range substitutions {
+		r, err := newSubstitution(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range r.handlers() {
+			if findHandler(h.Name) != nil {
+				return nil, fmt.Errorf("substitution %s: handler %s already exists", c.Name, h.Name)
+			}
+			configured[h.Message] = sortHandlers(append(configured[h.Message], h))
+		}
+	}
+	return configured, nil
+}
+
+func newSubstitution(c *config.ConfigSubstitution) (*substitution, error) {
+	r := &substitution{ConfigSubstitution: c}
+	var err error
+	if r.requestFields, err = compileFieldExpressions(c.RequestFields); err != nil {
+		return nil, fmt.Errorf("substitution %s: %w", c.Name, err)
+	}
+	if r.responseFields, err = compileFieldExpressions(c.ResponseFields); err != nil {
+		return nil, fmt.Errorf("substitution %s: %w", c.Name, err)
+	}
+	return r, nil
+}
+
+func compileFieldExpressions(fields map[string]string) ([]*fieldExpression, error) {
+	var out []*fieldExpression
+	for field, text := range fields {
+		expr, err := compileExpression(text)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		out = append(out, &fieldExpression{path: strings.Split(field, "."), expr: expr})
+	}
+	// Nested fields are set after their parents.
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].path, ".") < strings.Join(out[j].path, ".")
+	})
+	return out, nil
+}
+
+func (r *substitution) handlers() []*Handler {
+	return []*Handler{
+		{Name: r.Name + "-req", Message: r.Request, Direction: ClientToServer, From: r.Client, To: r.Server, Handle: r.onRequest},
+		{Name: r.Name + "-rsp", Message: r.UpstreamResponse, Direction: ServerToClient, From: r.Server, To: r.Client, Handle: r.onResponse},
+	}
+}
+
+// onRequest replaces the request of the client with the upstream request,
+// and remembers it by its client sequence id for the response.
+func (r *substitution) onRequest(s *Session, from, to mapper.Protocol, head, data []byte) (*Result, error) {
+	m := s.Mapping()
+	in, err := decodeObject(data)
+	if err != nil {
+		return nil, err
+	}
+	scope := &exprScope{packet: in, packetDesc: m.MessageDescMap[from][r.Request]}
+	p, err := r.build(m, scope, to, r.UpstreamRequest, r.requestFields)
+	if err != nil {
+		return nil, err
+	}
+	s.substituted.put(r.Name, ClientSequenceID(m, from, head), in)
+	logger.Debug().RawJSON("from", data).RawJSON("to", p).
+		Msgf("Rewriting %s:%s to %s:%s", from, r.Request, to, r.UpstreamRequest)
+	return ReplacePacket(&Packet{Name: r.UpstreamRequest, Data: p}), nil
+}
+
+// onResponse turns the upstream response answering a substituted request
+// into the response of the client, the other responses are forwarded.
+func (r *substitution) onResponse(s *Session, from, to mapper.Protocol, head, data []byte) (*Result, error) {
+	m := s.Mapping()
+	request, ok := s.substituted.take(r.Name, ClientSequenceID(m, from, head))
+	if !ok {
+		return ForwardPacket(data), nil
+	}
+	in, err := decodeObject(data)
+	if err != nil {
+		return nil, err
+	}
+	scope := &exprScope{
+		packet: in, packetDesc: m.MessageDescMap[from][r.UpstreamResponse],
+		request: request, requestDesc: m.MessageDescMap[to][r.Request],
+	}
+	p, err := r.build(m, scope, to, r.Response, r.responseFields)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug().RawJSON("from", data).RawJSON("to", p).
+		Msgf("Rewriting %s:%s to %s:%s", from, r.UpstreamResponse, to, r.Response)
+	return ReplacePacket(&Packet{Name: r.Response, Data: p}), nil
+}
+
+// build returns the JSON of the message name of v, with the fields of the
+// packet of the same name and the fields set by the expressions.
+func (r *substitution) build(m *mapper.Mapping, scope *exprScope, v mapper.Protocol, name string, fields []*fieldExpression) ([]byte, error) {
+	md := m.MessageDescMap[v][name]
+	if md == nil {
+		return nil, fmt.Errorf("unknown message %s in %s", name, v)
+	}
+	out := make(map[string]any)
+	for key, value := range scope.packet {
+		if fd := findJSONField(scope.packetDesc, key); fd != nil {
+			if to := md.FindFieldByName(fd.GetName()); to != nil {
+				out[to.GetJSONName()] = value
+			}
+		}
+	}
+	for _, f := range fields {
+		value, err := f.expr.Eval(scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set %s of %s: %w", strings.Join(f.path, "."), name, err)
+		}
+		if value != nil {
+			setObjectPath(out, md, f.path, value)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// setObjectPath sets the value at the path, by proto or JSON names, creating
+// the parent objects.
+func setObjectPath(obj map[string]any, md *desc.MessageDescriptor, path []string, value any) {
+	for i, name := range path {
+		key := name
+		fd := findJSONField(md, name)
+		if fd != nil {
+			key, md = fd.GetJSONName(), fd.GetMessageType()
+		}
+		if i == len(path)-1 {
+			if fd != nil {
+				value = clampInteger(fd, value)
+			}
+			obj[key] = value
+			return
+		}
+		child, ok := obj[key].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			obj[key] = child
+		}
+		obj = child
+	}
+}
+
+// clampInteger fits an integral value in the range of the integer field, a
+// negative value of an unsigned field is 0.
+func clampInteger(fd *desc.FieldDescriptor, value any) any {
+	i, ok := value.(int64)
+	if !ok {
+		return value
+	}
+	var lo, hi int64
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		lo, hi = math.MinInt32, math.MaxInt32
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		lo, hi = 0, math.MaxUint32
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		lo, hi = 0, math.MaxInt64
+	default:
+		return value
+	}
+	if i < lo {
+		return lo
+	}
+	if i > hi {
+		return hi
+	}
+	return i
+}
+
+func decodeObject(data []byte) (map[string]any, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	obj := make(map[string]any)
+	if err := d.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+type substitutedKey struct {
+	name string
+	seq  uint32
+}
+
+// substitutedRequests are the requests of the client replaced by a
+// substitution, by the substitution and the client sequence id. The requests
+// without a sequence id are queued, the server answers them in order.
+type substitutedRequests struct {
+	mu       sync.Mutex
+	requests map[substitutedKey][]map[string]any
+	order    []substitutedKey
+}
+
+func (r *substitutedRequests) put(name string, seq uint32, request map[string]any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.requests == nil {
+		r.requests = make(map[substitutedKey][]map[string]any)
+	}
+	key := substitutedKey{name, seq}
+	if queued := r.requests[key]; seq != 0 && len(queued) > 0 {
+		// A request sent again replaces the one of the same sequence id.
+		queued[0] = request
+		return
+	}
+	r.requests[key] = append(r.requests[key], request)
+	r.order = append(r.order, key)
+	for len(r.order) > maxSubstituted {
+		r.remove(r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *substitutedRequests) take(name string, seq uint32) (map[string]any, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := substitutedKey{name, seq}
+	queued := r.requests[key]
+	if len(queued) == 0 {
+		return nil, false
+	}
+	r.remove(key)
+	for i, k := range r.order {
+		if k == key {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return queued[0], true
+}
+
+// remove drops the oldest request of the key, its order is left to the
+// caller.
+func (r *substitutedRequests) remove(key substitutedKey) {
+	if queued := r.requests[key]; len(queued) > 1 {
+		r.requests[key] = queued[1:]
+	} else {
+		delete(r.requests, key)
+	}
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+)
+
+func TestGameTimeSubstitution(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {
+			"ClientSetGameTimeReq": `message ClientSetGameTimeReq { bool is_force_set = 1; uint32 game_time = 2; uint32 client_game_time = 3; }`,
+			"ChangeGameTimeReq":    `message ChangeGameTimeReq { bool is_force_set = 1; uint32 game_time = 2; uint32 extra_days = 3; }`,
+		},
+	}, map[mapper.Protocol]string{"v1.0.0": "ClientSetGameTimeReq,1\nChangeGameTimeReq,2\n"})
+	s := newTestSession(m, nil)
+	h := findHandler("game-time-req")
+	if h == nil {
+		t.Fatal("no game-time-req handler")
+	}
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			"later",
+			`{"isForceSet": true, "gameTime": 4400, "clientGameTime": 1000}`,
+			map[string]any{"isForceSet": true, "gameTime": 80.0, "extraDays": 2.0},
+		},
+		{
+			"earlier",
+			`{"gameTime": 100, "clientGameTime": 3000}`,
+			map[string]any{"gameTime": 100.0, "extraDays": 0.0},
+		},
+	}
+	for _, tt := range tests {
+		result, err := h.Handle(s, "v1.0.0", "v1.0.0", nil, []byte(tt.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(result.Packets) != 1 || result.Packets[0].Name != "ChangeGameTimeReq" {
+			t.Fatalf("%s: packets %+v, want a ChangeGameTimeReq", tt.name, result.Packets)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(result.Packets[0].Data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ChangeGameTimeReq %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClampInteger(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {"Fields": `message Fields { int32 a = 1; uint32 b = 2; uint64 c = 3; int64 d = 4; float e = 5; string f = 6; }`},
+	}, map[mapper.Protocol]string{"v1.0.0": "Fields,1\n"})
+	md := m.MessageDescMap["v1.0.0"]["Fields"]
+	tests := []struct {
+		field string
+		in    any
+		want  any
+	}{
+		{"a", int64(-1 << 40), int64(-1 << 31)},
+		{"a", int64(1 << 40), int64(1<<31 - 1)},
+		{"a", int64(-5), int64(-5)},
+		{"b", int64(-5), int64(0)},
+		{"b", int64(1 << 40), int64(1<<32 - 1)},
+		{"c", int64(-5), int64(0)},
+		{"d", int64(-5), int64(-5)},
+		{"e", int64(-5), int64(-5)},
+		{"b", 2.5, 2.5},
+		{"f", "x", "x"},
+	}
+	for _, tt := range tests {
+		if got := clampInteger(md.FindFieldByName(tt.field), tt.in); got != tt.want {
+			t.Errorf("clampInteger(%s, %v) = %v, want %v", tt.field, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGameTimeSubstitutionInOrder(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {
+			"ClientSetGameTimeReq": `message ClientSetGameTimeReq { uint32 game_time = 2; uint32 client_game_time = 3; }`,
+			"ClientSetGameTimeRsp": `message ClientSetGameTimeRsp { int32 retcode = 1; uint32 game_time = 2; uint32 client_game_time = 3; }`,
+			"ChangeGameTimeReq":    `message ChangeGameTimeReq { uint32 game_time = 2; uint32 extra_days = 3; }`,
+			"ChangeGameTimeRsp":    `message ChangeGameTimeRsp { int32 retcode = 1; uint32 game_time = 2; }`,
+		},
+	}, map[mapper.Protocol]string{"v1.0.0": "ClientSetGameTimeReq,1\nClientSetGameTimeRsp,2\nChangeGameTimeReq,3\nChangeGameTimeRsp,4\n"})
+	s := newTestSession(m, nil)
+	req, rsp := findHandler("game-time-req"), findHandler("game-time-rsp")
+	// Two requests without a client sequence id are pending at once.
+	for _, in := range []string{`{"gameTime": 100, "clientGameTime": 1}`, `{"gameTime": 200, "clientGameTime": 2}`} {
+		if _, err := req.Handle(s, "v1.0.0", "v1.0.0", nil, []byte(in)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []map[string]any{
+		{"retcode": 0.0, "gameTime": 100.0, "clientGameTime": 1.0},
+		{"retcode": 0.0, "gameTime": 200.0, "clientGameTime": 2.0},
+	} {
+		result, err := rsp.Handle(s, "v1.0.0", "v1.0.0", nil, []byte(`{"retcode": 0, "gameTime": 7}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Action != ActionReplace || result.Packets[0].Name != "ClientSetGameTimeRsp" {
+			t.Fatalf("got %s %+v, want a ClientSetGameTimeRsp", result.Action, result.Packets)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(result.Packets[0].Data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ClientSetGameTimeRsp %v, want %v", got, want)
+		}
+	}
+	// The third response answers no request.
+	result, err := rsp.Handle(s, "v1.0.0", "v1.0.0", nil, []byte(`{"gameTime": 7}`))
+	if err != nil || result.Action != ActionForward {
+		t.Errorf("got %v %v, want the response forwarded", result, err)
+	}
+}
+
+func TestSubstitutedRequests(t *testing.T) {
+	var r substitutedRequests
+	request := func(i int) map[string]any { return map[string]any{"i": i} }
+	take := func(name string, seq uint32) any {
+		request, ok := r.take(name, seq)
+		if !ok {
+			return nil
+		}
+		return request["i"]
+	}
+
+	r.put("a", 0, request(1))
+	r.put("a", 0, request(2))
+	r.put("a", 5, request(3))
+	// The same sequence id is the same request sent again.
+	r.put("a", 5, request(4))
+	r.put("b", 0, request(5))
+	for _, step := range []struct {
+		name string
+		seq  uint32
+		want any
+	}{
+		{"a", 5, 4},
+		{"a", 5, nil},
+		{"a", 0, 1},
+		{"b", 0, 5},
+		{"a", 0, 2},
+		{"a", 0, nil},
+	} {
+		if got := take(step.name, step.seq); got != step.want {
+			t.Errorf("take(%s, %d) = %v, want %v", step.name, step.seq, got, step.want)
+		}
+	}
+
+	// The oldest requests are forgotten first.
+	for i := 0; i < maxSubstituted+2; i++ {
+		r.put("a", 0, request(i))
+	}
+	if got := take("a", 0); got != 2 {
+		t.Errorf("oldest remembered request %v, want 2", got)
+	}
+	if len(r.order) != maxSubstituted-1 || len(r.requests[substitutedKey{"a", 0}]) != maxSubstituted-1 {
+		t.Errorf("remembered %d requests in order, %d queued, want %d", len(r.order), len(r.requests[substitutedKey{"a", 0}]), maxSubstituted-1)
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+	"github.com/Jx2f/ViaGenshin/pkg/transport/kcp"
+)
+
+// retFail is the retcode of the stub responses by default.
+const retFail = 1
+
+// handleUnpaired runs the handlers of a command of from with no pair in to,
+// it returns nil unless they drop or replace it, and the command is then
+// handled as configured in unknownCommands.
+func (s *Session) handleUnpaired(
+	m *mapper.Mapping, dir Direction, from, to mapper.Protocol, fromCmd uint16, head, data []byte,
+) (*Result, error) {
+	name := m.CommandNameMap[from][fromCmd]
+	handlers := s.Handlers(dir, from, to, name)
+	if len(handlers) == 0 {
+		return nil, nil
+	}
+	result, err := s.handleCommand(m, handlers, from, to, name, head, data)
+	if err != nil {
+		return nil, err
+	}
+	if result.Action != ActionDrop && result.Action != ActionReplace {
+		return nil, nil
+	}
+	logger.Debug().Msgf("Packet %s from %s handled with %s, it has no pair in %s", name, from, result.Action, to)
+	return result, nil
+}
+
+// unknownCommand handles a command of from with no pair in to, as configured
+// in unknownCommands. Only the requests of the client are stubbed, the other
+// commands are dropped in the stub mode.
+func (s *Session) unknownCommand(
+	m *mapper.Mapping, fromSession, toSession *kcp.Session, dir Direction,
+	from, to mapper.Protocol, fromCmd uint16, head, data []byte,
+) error {
+	c := s.Service.config.UnknownCommands
+	if c == nil {
+		c = &config.ConfigUnknownCommands{Mode: config.UnknownCommandDrop}
+	}
+	name := m.CommandNameMap[from][fromCmd]
+	switch c.Mode {
+	case config.UnknownCommandPassthrough:
+		logger.Debug().Msgf("Passing %s(%d) of %s through, it has no pair in %s", name, fromCmd, from, to)
+		return s.SendPacket(toSession, to, fromCmd, head, data)
+	case config.UnknownCommandStub:
+		if dir == ClientToServer && strings.HasSuffix(name, "Req") {
+			p, err := s.stubResponse(m, c, from, strings.TrimSuffix(name, "Req")+"Rsp")
+			if err != nil {
+				return fmt.Errorf("failed to stub %s of %s: %w", name, from, err)
+			}
+			logger.Debug().RawJSON("to", p.Data).Msgf("Answering %s(%d) of %s with a stub, it has no pair in %s", name, fromCmd, from, to)
+			return s.SendResult(fromSession, toSession, from, to, 0, head, ReplacePacket(p))
+		}
+	}
+	logger.Debug().Msgf("Dropping %s(%d) of %s, it has no pair in %s", name, fromCmd, from, to)
+	return nil
+}
+
+// stubResponse builds the response from its canned JSON, with the retcode
+// unless the canned JSON sets it.
+func (s *Session) stubResponse(m *mapper.Mapping, c *config.ConfigUnknownCommands, v mapper.Protocol, name string) (*Packet, error) {
+	md := m.MessageDescMap[v][name]
+	if md == nil {
+		return nil, fmt.Errorf("unknown message %s in %s", name, v)
+	}
+	body := make(map[string]any)
+	if canned := c.Responses[name]; len(canned) > 0 {
+		if err := json.Unmarshal(canned, &body); err != nil {
+			return nil, fmt.Errorf("invalid canned response %s: %w", name, err)
+		}
+	}
+	if fd := md.FindFieldByName("retcode"); fd != nil {
+		if _, ok := body[fd.GetJSONName()]; !ok {
+			retcode := c.Retcode
+			if retcode == 0 {
+				retcode = retFail
+			}
+			body[fd.GetJSONName()] = retcode
+		}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Packet{Name: name, Data: data, Reply: true}, nil
+}
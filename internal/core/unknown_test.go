@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/internal/mapper"
+	"github.com/Jx2f/ViaGenshin/pkg/crypto/mt19937"
+)
+
+func TestUnknownCommand(t *testing.T) {
+	m := newTestMapping(t, "v1.0.0", map[mapper.Protocol]map[string]string{
+		"v1.0.0": {
+			"PingReq":   `message PingReq { uint32 seq = 1; }`,
+			"OldReq":    `message OldReq { uint32 id = 1; }`,
+			"OldRsp":    `message OldRsp { int32 retcode = 1; string msg = 2; }`,
+			"LoneReq":   `message LoneReq { uint32 id = 1; }`,
+			"OldNotify": `message OldNotify { uint32 id = 1; }`,
+		},
+		"v2.0.0": {"PingReq": `message PingReq { uint32 seq = 1; }`},
+	}, map[mapper.Protocol]string{
+		"v1.0.0": "PingReq,1\nOldReq,30\nOldRsp,31\nLoneReq,32\nOldNotify,33\n",
+		"v2.0.0": "PingReq,1\n",
+	})
+	data := []byte{0x08, 7}
+	stub := func(retcode int32, responses map[string]string) *config.ConfigUnknownCommands {
+		c := &config.ConfigUnknownCommands{Mode: config.UnknownCommandStub, Retcode: retcode, Responses: make(map[string]json.RawMessage)}
+		for name, response := range responses {
+			c.Responses[name] = json.RawMessage(response)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		c       *config.ConfigUnknownCommands
+		dir     Direction
+		cmd     uint16
+		sent    uint16 // the command sent back, 0 if none
+		want    string // the JSON of the stub response
+		wantErr string
+	}{
+		{"drop by default", nil, ClientToServer, 30, 0, "", ""},
+		{"drop", &config.ConfigUnknownCommands{Mode: config.UnknownCommandDrop}, ClientToServer, 30, 0, "", ""},
+		{"passthrough", &config.ConfigUnknownCommands{Mode: config.UnknownCommandPassthrough}, ClientToServer, 30, 30, "", ""},
+		{"passthrough of the server", &config.ConfigUnknownCommands{Mode: config.UnknownCommandPassthrough}, ServerToClient, 33, 33, "", ""},
+		{"stub with the default retcode", stub(0, nil), ClientToServer, 30, 31, `{"retcode":1}`, ""},
+		{"stub with the retcode", stub(-1, nil), ClientToServer, 30, 31, `{"retcode":-1}`, ""},
+		{"stub with a canned response", stub(0, map[string]string{"OldRsp": `{"msg":"canned"}`}), ClientToServer, 30, 31, `{"retcode":1,"msg":"canned"}`, ""},
+		{"stub with a canned retcode", stub(-1, map[string]string{"OldRsp": `{"retcode":0}`}), ClientToServer, 30, 31, `{}`, ""},
+		{"stub without a response", stub(0, nil), ClientToServer, 32, 0, "", "unknown message LoneRsp in v1.0.0"},
+		{"stub of a notify", stub(0, nil), ClientToServer, 33, 0, "", ""},
+		{"stub of the server", stub(0, nil), ServerToClient, 30, 0, "", ""},
+	}
+	for _, tt := range tests {
+		// A packet left unreceived is taken by the next receivePacket, each
+		// case has its own connection.
+		client, endpoint := dialTestSession(t)
+		s := newTestSession(m, nil)
+		s.loginKey = mt19937.NewKeyBlock(7)
+		s.Service.config.UnknownCommands = tt.c
+		payload := encodeTestPayload(s, tt.cmd, nil, data)
+		err := s.ConvertPayload(endpoint, endpoint, tt.dir, "v1.0.0", "v2.0.0", payload)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v, want %s", tt.name, err, tt.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+
+		cmd, _, got, ok := receivePacket(t, s, client)
+		if tt.sent == 0 {
+			if ok {
+				t.Errorf("%s: sent %d, want nothing", tt.name, cmd)
+			}
+			continue
+		}
+		if !ok || cmd != tt.sent {
+			t.Errorf("%s: sent %d %t, want %d", tt.name, cmd, ok, tt.sent)
+			continue
+		}
+		if tt.want == "" {
+			// Passed through with the command id and data of the packet.
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s: sent %x, want %x", tt.name, got, data)
+			}
+			continue
+		}
+		msg := dynamic.NewMessage(m.MessageDescMap["v1.0.0"]["OldRsp"])
+		if err := msg.Unmarshal(got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want := dynamic.NewMessage(m.MessageDescMap["v1.0.0"]["OldRsp"])
+		if err := want.UnmarshalJSON([]byte(tt.want)); err != nil {
+			t.Fatal(err)
+		}
+		if !dynamic.Equal(msg, want) {
+			t.Errorf("%s: sent %s, want %s", tt.name, msg, want)
+		}
+	}
+}
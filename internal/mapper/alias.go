@@ -0,0 +1,69 @@
+package mapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// loadAliases reads data/mapping/{{ VERSION }}/aliases.json, mapping the
+// message names of a dump to the canonical names of the base protocol.
+func (m *Mapping) loadAliases(v Protocol, src *protocolSource) error {
+	aliases := make(map[string]string)
+	m.MessageAliasMap[v] = aliases
+	m.MessageLocalMap[v] = make(map[string]string)
+	file := src.path("aliases.json")
+	data, err := fs.ReadFile(src, "aliases.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read aliases %s: %w", file, err)
+	}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return fmt.Errorf("failed to parse aliases %s: %w", file, err)
+	}
+	logger.Info().Msgf("Loaded %d aliases in %s", len(aliases), v)
+	m.MessageLocalMap[v] = localNames(v, aliases)
+	return nil
+}
+
+// localNames reverses the aliases, of the local names aliasing the same
+// canonical name the first in order is kept.
+func localNames(v Protocol, aliases map[string]string) map[string]string {
+	locals := make([]string, 0, len(aliases))
+	for local := range aliases {
+		locals = append(locals, local)
+	}
+	sort.Strings(locals)
+	names := make(map[string]string, len(aliases))
+	for _, local := range locals {
+		name := aliases[local]
+		if prev, ok := names[name]; ok {
+			logger.Warn().Msgf("Messages %s and %s are both aliases of %s in %s, %s is used", prev, local, name, v, prev)
+			continue
+		}
+		names[name] = local
+	}
+	return names
+}
+
+// CanonicalName returns the name of the message of the protocol as known to
+// the base protocol.
+func (m *Mapping) CanonicalName(v Protocol, local string) string {
+	if name, ok := m.MessageAliasMap[v][local]; ok {
+		return name
+	}
+	return local
+}
+
+// LocalName returns the name of the message in the dump of the protocol.
+func (m *Mapping) LocalName(v Protocol, name string) string {
+	if local, ok := m.MessageLocalMap[v][name]; ok {
+		return local
+	}
+	return name
+}
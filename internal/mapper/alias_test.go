@@ -0,0 +1,59 @@
+package mapper
+
+import (
+	"testing"
+)
+
+func TestLocalNames(t *testing.T) {
+	aliases := map[string]string{
+		"EvtBeingHitNotify":           "EvtBeingHitInfo",
+		"EvtBeingHit":                 "EvtBeingHitInfo",
+		"EvtBeingHitInfoV2":           "EvtBeingHitInfo",
+		"AbilityActionFireAfterImage": "AbilityActionFireAfterImgae",
+	}
+	want := map[string]string{
+		"EvtBeingHitInfo":             "EvtBeingHit",
+		"AbilityActionFireAfterImgae": "AbilityActionFireAfterImage",
+	}
+	for i := 0; i < 10; i++ {
+		names := localNames("v2", aliases)
+		if len(names) != len(want) {
+			t.Fatalf("got %v, want %v", names, want)
+		}
+		for name, local := range want {
+			if names[name] != local {
+				t.Fatalf("local name of %s = %s, want %s", name, names[name], local)
+			}
+		}
+	}
+}
+
+func TestRulesByCanonicalName(t *testing.T) {
+	protocol := func(csv, local, field string) map[string]string {
+		files := map[string]string{
+			"protocol.csv":   csv,
+			"arguments.json": `{"ability": [], "combat": []}`,
+			"protocol/" + local + ".proto": `syntax = "proto3";
+message ` + local + ` { uint32 attacker_id = 1; float ` + field + ` = 2; }`,
+		}
+		if local != "EvtBeingHitInfo" {
+			files["aliases.json"] = `{"` + local + `": "EvtBeingHitInfo"}`
+		}
+		return files
+	}
+	v2 := protocol("EvtBeingHitNotify,20\n", "EvtBeingHitNotify", "damage")
+	v2["rules/v3.json"] = `[{"message": "EvtBeingHitInfo", "rename": {"damage": "dmg"}}]`
+	m := newTestMapping(t, "v1", map[Protocol]map[string]string{
+		"v1": protocol("EvtBeingHitInfo,10\n", "EvtBeingHitInfo", "damage"),
+		"v2": v2,
+		"v3": protocol("EvtBeingHit,30\n", "EvtBeingHit", "dmg"),
+	})
+	if got := m.LocalName("v3", "EvtBeingHitInfo"); got != "EvtBeingHit" {
+		t.Errorf("local name = %s, want EvtBeingHit", got)
+	}
+	checkConverted(t, m, "v2", "v3", "EvtBeingHitInfo", `{"attackerId":1,"damage":2.5}`, `{"attackerId":1,"dmg":2.5}`)
+	checkConverted(t, m, "v3", "v2", "EvtBeingHitInfo", `{"attackerId":1,"dmg":2.5}`, `{"attackerId":1,"damage":2.5}`)
+	if m.SchemaEqual("v2", "v3", "EvtBeingHitInfo") {
+		t.Error("the message with rules has the same schema")
+	}
+}
@@ -0,0 +1,196 @@
+package mapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// Argument is an argument type of the ability or combat invokes, Message is
+// the canonical name of the message of the payload, empty if unknown.
+type Argument struct {
+	ID      uint32 `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ArgumentTable is the AbilityInvokeArgument or CombatTypeArgument table of a
+// protocol.
+type ArgumentTable struct {
+	ByID   map[uint32]*Argument
+	ByName map[string]*Argument
+}
+
+func newArgumentTable(arguments []*Argument) *ArgumentTable {
+	t := &ArgumentTable{
+		ByID:   make(map[uint32]*Argument),
+		ByName: make(map[string]*Argument),
+	}
+	for _, a := range arguments {
+		t.ByID[a.ID] = a
+		if a.Name != "" {
+			t.ByName[a.Name] = a
+		}
+	}
+	return t
+}
+
+// Message returns the message of the payload of the argument, or an empty
+// string if unknown.
+func (t *ArgumentTable) Message(id uint32) string {
+	if t == nil {
+		return ""
+	}
+	if a := t.ByID[id]; a != nil {
+		return a.Message
+	}
+	return ""
+}
+
+// Translate returns the id of the same argument in the other table, matched
+// by the constant name, or by the message of an argument without a name
+// under the same id, false if it cannot be matched.
+func (t *ArgumentTable) Translate(to *ArgumentTable, id uint32) (uint32, bool) {
+	if t == nil || to == nil {
+		return 0, false
+	}
+	a := t.ByID[id]
+	if a == nil {
+		return 0, false
+	}
+	if a.Name != "" {
+		if b := to.ByName[a.Name]; b != nil {
+			return b.ID, true
+		}
+		return 0, false
+	}
+	if b := to.ByID[id]; b != nil && b.Message != "" && b.Message == a.Message {
+		return id, true
+	}
+	return 0, false
+}
+
+type argumentsConfig struct {
+	Ability []*Argument `json:"ability"`
+	Combat  []*Argument `json:"combat"`
+}
+
+// loadArguments reads the argument tables of a protocol from
+// data/mapping/{{ VERSION }}/arguments.json, or builds them from the
+// AbilityInvokeArgument and CombatTypeArgument enums of its protos, or falls
+// back to the default tables, then parses the messages of the payloads.
+func (m *Mapping) loadArguments(files *protoFiles, v Protocol, src *protocolSource) error {
+	c := new(argumentsConfig)
+	file := src.path("arguments.json")
+	data, err := fs.ReadFile(src, "arguments.json")
+	if err == nil {
+		if err := json.Unmarshal(data, c); err != nil {
+			return fmt.Errorf("failed to parse arguments %s: %w", file, err)
+		}
+		logger.Info().Msgf("Loaded %d ability and %d combat arguments in %s", len(c.Ability), len(c.Combat), v)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read arguments %s: %w", file, err)
+	}
+	if c.Ability == nil {
+		c.Ability = m.enumArguments(v, files, "AbilityInvokeArgument", "ABILITY_INVOKE_ARGUMENT_", AbilityInvokeArguments, abilityArgumentMessages)
+	}
+	if c.Combat == nil {
+		c.Combat = m.enumArguments(v, files, "CombatTypeArgument", "COMBAT_TYPE_ARGUMENT_", CombatTypeArguments, combatArgumentMessages)
+	}
+	m.AbilityArgumentMap[v] = newArgumentTable(c.Ability)
+	m.CombatArgumentMap[v] = newArgumentTable(c.Combat)
+	for _, arguments := range [][]*Argument{c.Ability, c.Combat} {
+		for _, a := range arguments {
+			if a.Message == "" || m.MessageDescMap[v][a.Message] != nil {
+				continue
+			}
+			local := m.LocalName(v, a.Message)
+			if err := m.parseMessageDesc(files, v, local, local+".proto"); err != nil {
+				logger.Warn().Err(err).Msgf("Failed to parse message desc for %s in %s", a.Message, v)
+				continue
+			}
+		}
+	}
+	return nil
+}
+
+// enumArguments builds the argument table from the enum of the protocol, the
+// message of each value is the one of the default table with the same
+// constant name, or guessed from the constant name. The default table is
+// returned if the protocol has no such enum.
+func (m *Mapping) enumArguments(v Protocol, files *protoFiles, enum, prefix string, defaults []*Argument, guess func(string) []string) []*Argument {
+	ed := findEnum(files, enum)
+	if ed == nil {
+		return defaults
+	}
+	known := make(map[string]*Argument)
+	for _, a := range defaults {
+		known[a.Name] = a
+	}
+	exists := func(local string) bool {
+		return files.has(local + ".proto")
+	}
+	var arguments []*Argument
+	for _, vd := range ed.GetValues() {
+		if vd.GetNumber() <= 0 {
+			continue
+		}
+		a := &Argument{ID: uint32(vd.GetNumber()), Name: vd.GetName()}
+		if d := known[a.Name]; d != nil && d.Message != "" && exists(m.LocalName(v, d.Message)) {
+			a.Message = d.Message
+		} else {
+			for _, local := range guess(strings.TrimPrefix(a.Name, prefix)) {
+				if exists(local) {
+					a.Message = m.CanonicalName(v, local)
+					break
+				}
+			}
+		}
+		arguments = append(arguments, a)
+	}
+	logger.Info().Msgf("Found %d %s values in %s", len(arguments), enum, v)
+	return arguments
+}
+
+func findEnum(files *protoFiles, enum string) *desc.EnumDescriptor {
+	fd, err := files.find(enum + ".proto")
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Warn().Err(err).Msgf("Failed to parse %s", enum)
+		}
+		return nil
+	}
+	return fd.FindEnum(enum)
+}
+
+// abilityArgumentMessages guesses the messages of an AbilityInvokeArgument,
+// ACTION_TRIGGER_ABILITY is carried by AbilityActionTriggerAbility.
+func abilityArgumentMessages(name string) []string {
+	return []string{"Ability" + camelCase(name)}
+}
+
+// combatArgumentMessages guesses the messages of a CombatTypeArgument,
+// ANIMATOR_STATE_CHANGED is carried by EvtAnimatorStateChangedInfo.
+func combatArgumentMessages(name string) []string {
+	name = camelCase(strings.TrimSuffix(name, "_NTF"))
+	name = strings.TrimPrefix(name, "Evt")
+	return []string{"Evt" + name + "Info", "Evt" + name, name + "Info", name, "Evt" + name + "Notify"}
+}
+
+func camelCase(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(part[:1])
+		b.WriteString(strings.ToLower(part[1:]))
+	}
+	return b.String()
+}
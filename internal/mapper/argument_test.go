@@ -0,0 +1,47 @@
+package mapper
+
+import (
+	"testing"
+)
+
+func TestArgumentTranslate(t *testing.T) {
+	from := newArgumentTable([]*Argument{
+		{ID: 21, Name: "ABILITY_INVOKE_ARGUMENT_META_LOSE_HP", Message: "AbilityMetaLoseHp"},
+		{ID: 50, Name: "ABILITY_INVOKE_ARGUMENT_ACTION_TRIGGER_ABILITY", Message: "AbilityActionTriggerAbility"},
+		{ID: 60, Name: "ABILITY_INVOKE_ARGUMENT_OLD_ONLY"},
+		{ID: 70, Message: "AbilityMixinNewThing"},
+		{ID: 80, Message: "AbilityMixinOldThing"},
+	})
+	to := newArgumentTable([]*Argument{
+		{ID: 23, Name: "ABILITY_INVOKE_ARGUMENT_META_LOSE_HP", Message: "AbilityMetaLoseHp"},
+		{ID: 52, Name: "ABILITY_INVOKE_ARGUMENT_ACTION_TRIGGER_ABILITY", Message: "AbilityActionTriggerAbility"},
+		{ID: 60, Name: "ABILITY_INVOKE_ARGUMENT_NEW_ONLY"},
+		{ID: 70, Message: "AbilityMixinNewThing"},
+		{ID: 80, Message: "AbilityMixinOtherThing"},
+	})
+	tests := []struct {
+		name string
+		id   uint32
+		want uint32
+		ok   bool
+	}{
+		{"by name", 21, 23, true},
+		{"by name again", 50, 52, true},
+		{"no counterpart", 60, 0, false},
+		{"unnamed, same message", 70, 70, true},
+		{"unnamed, other message", 80, 0, false},
+		{"unknown id", 99, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := from.Translate(to, tt.id)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: Translate(%d) = %d, %t, want %d, %t", tt.name, tt.id, got, ok, tt.want, tt.ok)
+		}
+	}
+	if _, ok := from.Translate(nil, 21); ok {
+		t.Error("translated to a missing table")
+	}
+	if got, ok := (argumentTables{"v1": from, "v2": to}).Translate("v2", "v1", 52); got != 50 || !ok {
+		t.Errorf("argumentTables.Translate(52) = %d, %t, want 50, true", got, ok)
+	}
+}
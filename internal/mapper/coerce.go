@@ -0,0 +1,230 @@
+package mapper
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// scalar coerces the value of a scalar field to the Go type of the target
+// field type.
+func (c *Converter) scalar(fromField, toField *desc.FieldDescriptor, value any) (any, bool) {
+	fromEnum, toEnum := fromField.GetEnumType(), toField.GetEnumType()
+	if fromEnum != nil && toEnum != nil {
+		return c.enum(fromField, toField, fromEnum, toEnum, value)
+	}
+	if fromField.GetType() == toField.GetType() {
+		return value, true
+	}
+	out, ok := coerceScalar(toField, value)
+	if !ok {
+		return c.fail(fromField, toField)
+	}
+	return out, true
+}
+
+// coerceScalar converts the value to the Go type of the field type.
+func coerceScalar(toField *desc.FieldDescriptor, value any) (out any, ok bool) {
+	switch toField.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		out, ok = coerceString(value)
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		if out, ok = coerceString(value); ok {
+			out = []byte(out.(string))
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		out, ok = coerceBool(value)
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		var f float64
+		if f, ok = coerceFloat(value); ok {
+			out = float32(f)
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		out, ok = coerceFloat(value)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		var n int64
+		if n, ok = coerceInt(value, 32); ok {
+			out = int32(n)
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		out, ok = coerceInt(value, 64)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		var n uint64
+		if n, ok = coerceUint(value, 32); ok {
+			out = uint32(n)
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		out, ok = coerceUint(value, 64)
+	}
+	return out, ok
+}
+
+// enum translates the enum value by its constant name, as the numbers may
+// be reassigned between the versions.
+func (c *Converter) enum(fromField, toField *desc.FieldDescriptor, fromEnum, toEnum *desc.EnumDescriptor, value any) (any, bool) {
+	number, ok := value.(int32)
+	if !ok {
+		return c.fail(fromField, toField)
+	}
+	name := strconv.FormatInt(int64(number), 10)
+	if fromValue := fromEnum.FindValueByNumber(number); fromValue != nil {
+		name = fromValue.GetName()
+	}
+	rules := c.enums[fromEnum.GetName()]
+	if rules == nil {
+		rules = c.enums[toEnum.GetName()]
+	}
+	if override, ok := rules[name]; ok {
+		name = override
+	} else if override, ok = rules[strconv.FormatInt(int64(number), 10)]; ok {
+		name = override
+	}
+	if toValue := toEnum.FindValueByName(name); toValue != nil {
+		return toValue.GetNumber(), true
+	}
+	if n, err := strconv.ParseInt(name, 10, 32); err == nil {
+		return int32(n), true
+	}
+	// Keep the number only if it does not stand for another value.
+	if toEnum.FindValueByNumber(number) != nil {
+		return c.fail(fromField, toField)
+	}
+	return number, true
+}
+
+// formatScalar returns the text form of a scalar value, integers keep their
+// full 64-bit range.
+func formatScalar(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+func coerceString(value any) (any, bool) {
+	return formatScalar(value)
+}
+
+func coerceBool(value any) (bool, bool) {
+	if b, ok := value.(bool); ok {
+		return b, true
+	}
+	s, ok := formatScalar(value)
+	if !ok {
+		return false, false
+	}
+	s = strings.TrimSpace(s)
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f != 0, err == nil
+}
+
+func coerceFloat(value any) (float64, bool) {
+	if b, ok := value.(bool); ok {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	s, ok := formatScalar(value)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f, err == nil
+}
+
+func coerceInt(value any, bits int) (int64, bool) {
+	if b, ok := value.(bool); ok {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	s, ok := formatScalar(value)
+	if !ok {
+		return 0, false
+	}
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, bits); err == nil {
+		return n, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < -math.Exp2(float64(bits-1)) || f >= math.Exp2(float64(bits-1)) {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func coerceUint(value any, bits int) (uint64, bool) {
+	if b, ok := value.(bool); ok {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	s, ok := formatScalar(value)
+	if !ok {
+		return 0, false
+	}
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseUint(s, 10, bits); err == nil {
+		return n, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || f >= math.Exp2(float64(bits)) {
+		return 0, false
+	}
+	return uint64(f), true
+}
+
+// FieldTypeName returns the type of the field as written in a proto file.
+func FieldTypeName(fd *desc.FieldDescriptor) string {
+	if fd == nil {
+		return "nothing"
+	}
+	var name string
+	if m := fd.GetMessageType(); m != nil {
+		name = m.GetName()
+	} else if e := fd.GetEnumType(); e != nil {
+		name = e.GetName()
+	} else {
+		name = strings.ToLower(strings.TrimPrefix(fd.GetType().String(), "TYPE_"))
+	}
+	if fd.IsMap() {
+		return "map<" + FieldTypeName(fd.GetMapKeyType()) + ", " + FieldTypeName(fd.GetMapValueType()) + ">"
+	}
+	if fd.IsRepeated() {
+		return "repeated " + name
+	}
+	return name
+}
@@ -0,0 +1,194 @@
+package mapper
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCoerceInt(t *testing.T) {
+	tests := []struct {
+		value any
+		bits  int
+		want  int64
+		ok    bool
+	}{
+		{int32(-5), 32, -5, true},
+		{uint64(1 << 40), 64, 1 << 40, true},
+		{uint64(1 << 40), 32, 0, false},
+		{"  12 ", 32, 12, true},
+		{"1.9", 32, 1, true},
+		{float32(-2.5), 32, -2, true},
+		{float64(1 << 31), 32, 0, false},
+		{true, 32, 1, true},
+		{"x", 32, 0, false},
+		{[]any{1}, 32, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := coerceInt(tt.value, tt.bits)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("coerceInt(%#v, %d) = %d, %t, want %d, %t", tt.value, tt.bits, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCoerceUint(t *testing.T) {
+	tests := []struct {
+		value any
+		bits  int
+		want  uint64
+		ok    bool
+	}{
+		{uint32(5), 32, 5, true},
+		{int32(-1), 32, 0, false},
+		{int64(-1), 64, 0, false},
+		{uint64(1 << 32), 32, 0, false},
+		{"18446744073709551615", 64, 1<<64 - 1, true},
+		{"3.7", 32, 3, true},
+		{false, 32, 0, true},
+		{"", 32, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := coerceUint(tt.value, tt.bits)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("coerceUint(%#v, %d) = %d, %t, want %d, %t", tt.value, tt.bits, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCoerceBoolAndFloat(t *testing.T) {
+	bools := []struct {
+		value any
+		want  bool
+		ok    bool
+	}{
+		{true, true, true},
+		{"false", false, true},
+		{uint32(0), false, true},
+		{int64(-3), true, true},
+		{"0.5", true, true},
+		{"yes", false, false},
+	}
+	for _, tt := range bools {
+		got, ok := coerceBool(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("coerceBool(%#v) = %t, %t, want %t, %t", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+	floats := []struct {
+		value any
+		want  float64
+		ok    bool
+	}{
+		{float32(0.5), 0.5, true},
+		{int64(-7), -7, true},
+		{" 2.25", 2.25, true},
+		{true, 1, true},
+		{[]byte("1e3"), 1000, true},
+		{"nan?", 0, false},
+	}
+	for _, tt := range floats {
+		got, ok := coerceFloat(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("coerceFloat(%#v) = %g, %t, want %g, %t", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFormatScalar(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{"a", "a"},
+		{[]byte("b"), "b"},
+		{true, "true"},
+		{int32(-1), "-1"},
+		{uint64(1<<64 - 1), "18446744073709551615"},
+		{float32(0.1), "0.1"},
+		{float64(1e21), "1e+21"},
+	}
+	for _, tt := range tests {
+		if got, ok := formatScalar(tt.value); !ok || got != tt.want {
+			t.Errorf("formatScalar(%#v) = %q, %t, want %q", tt.value, got, ok, tt.want)
+		}
+	}
+	if _, ok := formatScalar(struct{}{}); ok {
+		t.Error("formatScalar of a struct succeeded")
+	}
+}
+
+func TestConvertScalar(t *testing.T) {
+	scalars := func(types ...string) string {
+		s := "syntax = \"proto3\";\nmessage ScalarNotify {\n"
+		for i, name := range []string{"a", "b", "c", "d", "e", "f"} {
+			s += "  " + types[i] + " " + name + " = " + strconv.Itoa(i+1) + ";\n"
+		}
+		return s + "}"
+	}
+	m := newTestMapping(t, "v1", map[Protocol]map[string]string{
+		"v1": {
+			"protocol.csv":                "ScalarNotify,10\n",
+			"arguments.json":              `{"ability": [], "combat": []}`,
+			"protocol/ScalarNotify.proto": scalars("uint32", "int64", "string", "float", "bool", "repeated uint32"),
+		},
+		"v2": {
+			"protocol.csv":                "ScalarNotify,20\n",
+			"arguments.json":              `{"ability": [], "combat": []}`,
+			"protocol/ScalarNotify.proto": scalars("string", "uint32", "int32", "int32", "uint32", "repeated string"),
+		},
+	})
+	tests := []struct {
+		name, in, want string
+	}{
+		{"widened", `{"a":7,"b":"12","c":"-3","d":2.5,"e":true,"f":[1,2]}`, `{"a":"7","b":12,"c":-3,"d":2,"e":1,"f":["1","2"]}`},
+		{"out of range", `{"b":"-1"}`, `{}`},
+		{"not a number", `{"c":"x"}`, `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkConverted(t, m, "v1", "v2", "ScalarNotify", tt.in, tt.want)
+		})
+	}
+}
+
+func TestConvertEnum(t *testing.T) {
+	m := newTestMapping(t, "v1", map[Protocol]map[string]string{
+		"v1": {
+			"protocol.csv":   "PingRsp,10\n",
+			"arguments.json": `{"ability": [], "combat": []}`,
+			"rules/v2.json":  `[{"enum": "Retcode", "values": {"RET_OLD": "RET_RENAMED", "9": "RET_NEW"}}]`,
+			"protocol/PingRsp.proto": `syntax = "proto3";
+enum Retcode { RET_SUCC = 0; RET_FAIL = 1; RET_OLD = 2; RET_GONE = 3; }
+message PingRsp { Retcode retcode = 1; }`,
+		},
+		"v2": {
+			"protocol.csv":   "PingRsp,20\n",
+			"arguments.json": `{"ability": [], "combat": []}`,
+			"protocol/PingRsp.proto": `syntax = "proto3";
+enum Retcode { RET_SUCC = 0; RET_NEW = 1; RET_BUSY = 2; RET_FAIL = 5; RET_RENAMED = 6; }
+message PingRsp { Retcode retcode = 1; }`,
+		},
+	})
+	tests := []struct {
+		name     string
+		from, to Protocol
+		in, want int
+	}{
+		{"same name", "v1", "v2", 1, 5},
+		{"renamed", "v1", "v2", 2, 6},
+		{"renamed back", "v2", "v1", 6, 2},
+		{"removed, number unused", "v1", "v2", 3, 3},
+		{"unknown number", "v1", "v2", 8, 8},
+		{"rule by number", "v1", "v2", 9, 1},
+		{"rule by number back", "v2", "v1", 1, 9},
+		{"same name back", "v2", "v1", 5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := `{"retcode":` + strconv.Itoa(tt.in) + `}`
+			checkConverted(t, m, tt.from, tt.to, "PingRsp", in, `{"retcode":`+strconv.Itoa(tt.want)+`}`)
+		})
+	}
+	// RET_BUSY has no counterpart and its number stands for RET_OLD.
+	checkConverted(t, m, "v2", "v1", "PingRsp", `{"retcode":2}`, `{}`)
+}
@@ -0,0 +1,239 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// commandEntry is a command of the command table of a protocol, File is the
+// proto file defining the message.
+type commandEntry struct {
+	Name string
+	ID   uint16
+	File string
+}
+
+type CommandFormat = config.CommandFormat
+
+// commandFiles are the command tables looked up in order when the format of
+// a protocol is not configured.
+var commandFiles = []struct {
+	File   string
+	Format CommandFormat
+}{
+	{"protocol.csv", config.CommandFormatCSV},
+	{"packetIds.json", config.CommandFormatPacketIDs},
+	{"cmdid.json", config.CommandFormatIDToName},
+}
+
+// readCommands reads the command table of a protocol from the configured
+// file, or from the first of the known files found in the protocol directory,
+// or from the CmdId enums of the messages if there is none.
+func (m *Mapping) readCommands(v Protocol, src *protocolSource, files *protoFiles) ([]*commandEntry, error) {
+	var file string
+	var format CommandFormat
+	if c := m.config.Commands[v]; c != nil {
+		file, format = c.File, c.Format
+	}
+	if file == "" && format == "" {
+		format = config.CommandFormatEnums
+		for _, f := range commandFiles {
+			if _, err := fs.Stat(src, f.File); err == nil {
+				file, format = f.File, f.Format
+				break
+			}
+		}
+	}
+	if format == "" {
+		format = config.CommandFormatIDToName
+		if strings.HasSuffix(file, ".csv") {
+			format = config.CommandFormatCSV
+		}
+	}
+	if format == config.CommandFormatEnums {
+		logger.Info().Msgf("No command table in %s, scanning CmdId enums", v)
+		return scanCommandEnums(v, files)
+	}
+	if file == "" {
+		for _, f := range commandFiles {
+			if f.Format == format {
+				file = f.File
+				break
+			}
+		}
+		if file == "" {
+			file = "cmdid.json"
+		}
+	}
+	data, err := fs.ReadFile(src, path.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	switch format {
+	case config.CommandFormatCSV:
+		return parseCommandCSV(v, data), nil
+	case config.CommandFormatIDToName, config.CommandFormatNameToID, config.CommandFormatPacketIDs:
+		commands, err := parseCommandJSON(v, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		return commands, nil
+	}
+	return nil, fmt.Errorf("unknown command table format %s", format)
+}
+
+func parseCommandCSV(v Protocol, data []byte) []*commandEntry {
+	var commands []*commandEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.Split(strings.TrimSpace(line), ",")
+		if len(parts) != 2 {
+			continue
+		}
+		name := parts[0]
+		if name == "" {
+			continue
+		}
+		command, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("Failed to parse command %s for %s in %s", parts[1], name, v)
+			continue
+		}
+		commands = append(commands, &commandEntry{Name: name, ID: uint16(command), File: name + ".proto"})
+	}
+	return commands
+}
+
+// parseCommandJSON parses a JSON object of either id to name or name to id,
+// the direction is told by the type of each value.
+func parseCommandJSON(v Protocol, data []byte) ([]*commandEntry, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	var commands []*commandEntry
+	for key, value := range object {
+		var name, id string
+		if err := json.Unmarshal(value, &name); err == nil {
+			id = key
+		} else {
+			name, id = key, string(value)
+		}
+		command, err := strconv.ParseUint(id, 10, 16)
+		if err != nil || name == "" {
+			logger.Warn().Msgf("Failed to parse command %s: %s in %s", key, value, v)
+			continue
+		}
+		commands = append(commands, &commandEntry{Name: name, ID: uint16(command), File: name + ".proto"})
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].ID < commands[j].ID })
+	return commands, nil
+}
+
+// WriteCommands writes the command table of the protocol in the format, the
+// commands are sorted by id.
+func (m *Mapping) WriteCommands(w io.Writer, v Protocol, format CommandFormat) error {
+	names, ok := m.CommandNameMap[v]
+	if !ok {
+		return fmt.Errorf("unknown protocol %s", v)
+	}
+	ids := make([]int, 0, len(names))
+	for id := range names {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	b := new(bytes.Buffer)
+	switch format {
+	case config.CommandFormatCSV:
+		for _, id := range ids {
+			fmt.Fprintf(b, "%s,%d\n", names[uint16(id)], id)
+		}
+	case config.CommandFormatIDToName, config.CommandFormatNameToID, config.CommandFormatPacketIDs:
+		// packetIds.json is indented, the others are written on a single line.
+		indent := ""
+		if format == config.CommandFormatPacketIDs {
+			indent = "\n  "
+		}
+		b.WriteString("{")
+		for i, id := range ids {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			name, _ := json.Marshal(names[uint16(id)])
+			b.WriteString(indent)
+			if format == config.CommandFormatNameToID {
+				fmt.Fprintf(b, "%s:%d", name, id)
+			} else if format == config.CommandFormatPacketIDs {
+				fmt.Fprintf(b, "\"%d\": %s", id, name)
+			} else {
+				fmt.Fprintf(b, "\"%d\":%s", id, name)
+			}
+		}
+		if format == config.CommandFormatPacketIDs {
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n")
+	default:
+		return fmt.Errorf("cannot write command table as %s", format)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// scanCommandEnums builds the command table from the `enum CmdId { CMD_ID = n; }`
+// declared inside the messages, the commands with a duplicate name or id are
+// reported and only the first one found is kept.
+func scanCommandEnums(v Protocol, files *protoFiles) ([]*commandEntry, error) {
+	ids := make(map[string]*commandEntry)
+	names := make(map[uint16]*commandEntry)
+	var commands []*commandEntry
+	for _, file := range files.names() {
+		for _, md := range files.files[file].GetMessageTypes() {
+			command, ok := messageCommandID(md.AsDescriptorProto())
+			if !ok {
+				continue
+			}
+			c := &commandEntry{Name: md.GetName(), ID: command, File: file}
+			if prev, ok := ids[c.Name]; ok {
+				logger.Warn().Msgf("Duplicate command %s in %s, %d in %s and %d in %s", c.Name, v, prev.ID, prev.File, c.ID, c.File)
+				continue
+			}
+			if prev, ok := names[c.ID]; ok {
+				logger.Warn().Msgf("Conflicting command id %d in %s, %s in %s and %s in %s", c.ID, v, prev.Name, prev.File, c.Name, c.File)
+				continue
+			}
+			ids[c.Name], names[c.ID] = c, c
+			commands = append(commands, c)
+		}
+	}
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("no CmdId enum found in %s", v)
+	}
+	logger.Info().Msgf("Found %d commands in %s", len(commands), v)
+	return commands, nil
+}
+
+func messageCommandID(md *descriptorpb.DescriptorProto) (uint16, bool) {
+	for _, ed := range md.GetEnumType() {
+		if ed.GetName() != "CmdId" {
+			continue
+		}
+		for _, vd := range ed.GetValue() {
+			if vd.GetName() == "CMD_ID" && vd.GetNumber() > 0 && vd.GetNumber() <= 0xFFFF {
+				return uint16(vd.GetNumber()), true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package mapper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+)
+
+func TestParseCommandJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []commandEntry
+		err  bool
+	}{
+		{
+			name: "id to name",
+			data: `{"11":"PingRsp","10":"PingReq"}`,
+			want: []commandEntry{{"PingReq", 10, "PingReq.proto"}, {"PingRsp", 11, "PingRsp.proto"}},
+		},
+		{
+			name: "name to id",
+			data: `{"PingRsp":11,"PingReq":10}`,
+			want: []commandEntry{{"PingReq", 10, "PingReq.proto"}, {"PingRsp", 11, "PingRsp.proto"}},
+		},
+		{
+			name: "packet ids",
+			data: "{\n  \"10\": \"PingReq\",\n  \"65535\": \"LastNotify\"\n}\n",
+			want: []commandEntry{{"PingReq", 10, "PingReq.proto"}, {"LastNotify", 65535, "LastNotify.proto"}},
+		},
+		{
+			name: "invalid entries are skipped",
+			data: `{"70000":"TooBigNotify","x":"NotANumber","12":"","PingReq":10,"Float":1.5}`,
+			want: []commandEntry{{"PingReq", 10, "PingReq.proto"}},
+		},
+		{
+			name: "not an object",
+			data: `["PingReq"]`,
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands, err := parseCommandJSON("v1", []byte(tt.data))
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %t", err, tt.err)
+			}
+			if len(commands) != len(tt.want) {
+				t.Fatalf("got %d commands, want %d", len(commands), len(tt.want))
+			}
+			for i, c := range commands {
+				if *c != tt.want[i] {
+					t.Errorf("command %d = %+v, want %+v", i, *c, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseCommandCSV(t *testing.T) {
+	commands := parseCommandCSV("v1", []byte("PingReq,10\r\n\nPingRsp, 11\nBad,x\n,12\nTooBig,70000\nLast,65535"))
+	want := []commandEntry{{"PingReq", 10, "PingReq.proto"}, {"Last", 65535, "Last.proto"}}
+	if len(commands) != len(want) {
+		t.Fatalf("got %d commands, want %d", len(commands), len(want))
+	}
+	for i, c := range commands {
+		if *c != want[i] {
+			t.Errorf("command %d = %+v, want %+v", i, *c, want[i])
+		}
+	}
+}
+
+func TestWriteCommands(t *testing.T) {
+	m := &Mapping{CommandNameMap: map[Protocol]map[uint16]string{"v1": {11: "PingRsp", 10: "PingReq"}}}
+	tests := []struct {
+		format CommandFormat
+		want   string
+	}{
+		{config.CommandFormatCSV, "PingReq,10\nPingRsp,11\n"},
+		{config.CommandFormatIDToName, `{"10":"PingReq","11":"PingRsp"}` + "\n"},
+		{config.CommandFormatNameToID, `{"PingReq":10,"PingRsp":11}` + "\n"},
+		{config.CommandFormatPacketIDs, "{\n  \"10\": \"PingReq\",\n  \"11\": \"PingRsp\"\n}\n"},
+	}
+	for _, tt := range tests {
+		b := new(bytes.Buffer)
+		if err := m.WriteCommands(b, "v1", tt.format); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.format, b.String(), tt.want)
+		}
+		commands, err := parseCommandJSON("v1", b.Bytes())
+		if tt.format != config.CommandFormatCSV && (err != nil || len(commands) != 2) {
+			t.Errorf("%s: failed to read back %q: %v", tt.format, b.String(), err)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package mapper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/codec"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// Converter copies a message of one protocol into the message of another
+// protocol field by field, applying the rules declared for the version pair,
+// translating enum values by name and coercing the fields whose type changed
+// between the versions.
+type Converter struct {
+	mapping  *Mapping
+	from, to Protocol
+	rules    map[string]*MessageRules
+	enums    map[string]EnumRules
+	ids      *IDFields
+
+	path         []string
+	unreconciled []string
+	dropped      []string
+}
+
+func (m *Mapping) NewConverter(from, to Protocol) *Converter {
+	return &Converter{
+		mapping: m,
+		from:    from,
+		to:      to,
+		rules:   m.MessageRulesMap[from][to],
+		enums:   m.EnumRulesMap[from][to],
+		ids:     m.IDFieldsMap[from][to],
+	}
+}
+
+// Unreconciled returns the fields dropped from the last conversion because
+// their value could not be coerced to the target type.
+func (c *Converter) Unreconciled() []string {
+	return c.unreconciled
+}
+
+// Dropped returns the fields set in the source of the last conversion that
+// have no counterpart in the target.
+func (c *Converter) Dropped() []string {
+	return c.dropped
+}
+
+// Convert returns a new message of toDesc converted from in, in may be
+// modified during the conversion.
+func (c *Converter) Convert(in *dynamic.Message, toDesc *desc.MessageDescriptor) *dynamic.Message {
+	c.path, c.unreconciled, c.dropped = c.path[:0], nil, nil
+	out, _ := c.message(in, toDesc)
+	return out
+}
+
+// message converts in to a message of toDesc, false if it holds an embedded
+// payload that cannot be converted, the element holding it is then removed.
+func (c *Converter) message(in *dynamic.Message, toDesc *desc.MessageDescriptor) (*dynamic.Message, bool) {
+	fromDesc := in.GetMessageDescriptor()
+	rules := c.rules[c.mapping.CanonicalName(c.from, fromDesc.GetName())]
+	if rules == nil {
+		rules = c.rules[c.mapping.CanonicalName(c.to, toDesc.GetName())]
+	}
+	type moved struct {
+		path  []string
+		value any
+	}
+	var moves []*moved
+	if rules != nil {
+		for _, move := range rules.Moves {
+			fromField, value, ok := takeFieldPath(in, move.From)
+			if !ok {
+				continue
+			}
+			toField, ok := findFieldPath(toDesc, move.To)
+			if !ok {
+				logger.Debug().Msgf("Failed to find field %v of %s", move.To, toDesc.GetFullyQualifiedName())
+				c.drop(move.From...)
+				continue
+			}
+			c.path = append(c.path, move.From...)
+			if value, ok = c.field(rules, fromField, toField, value); ok {
+				moves = append(moves, &moved{move.To, value})
+			}
+			c.path = c.path[:len(c.path)-len(move.From)]
+		}
+	}
+	embedded := c.mapping.EmbeddedFieldMap[c.from][fromDesc.GetName()]
+	out := dynamic.NewMessage(toDesc)
+	pairs := c.mapping.fieldPairs(fromDesc, toDesc)
+	valid := true
+	for i, fromField := range fromDesc.GetFields() {
+		toField := pairs[i]
+		if !in.HasField(fromField) {
+			continue
+		}
+		if toField == nil {
+			c.drop(fromField.GetName())
+			continue
+		}
+		c.path = append(c.path, fromField.GetName())
+		var value any
+		var ok bool
+		if e := findEmbeddedField(embedded, fromField.GetName()); e != nil {
+			value, ok = c.embedded(e, in, fromField, toField)
+			valid = valid && ok
+		} else if e := findPayloadType(embedded, fromField.GetName()); e != nil {
+			value, ok = c.payloadType(e, fromField, toField, in.GetField(fromField))
+			valid = valid && ok
+		} else {
+			value, ok = c.field(rules, fromField, toField, in.GetField(fromField))
+		}
+		if t := c.ids.Find(fromDesc.GetName(), fromField.GetName()); ok && t != nil {
+			value, ok = c.remapIDs(t, toField, value)
+		}
+		if ok {
+			c.set(out, toField, value)
+		}
+		c.path = c.path[:len(c.path)-1]
+	}
+	for _, move := range moves {
+		c.path = append(c.path, move.path...)
+		if parent, toField := makeFieldPath(out, move.path); parent != nil {
+			c.set(parent, toField, move.value)
+		}
+		c.path = c.path[:len(c.path)-len(move.path)]
+	}
+	if rules != nil {
+		for _, field := range rules.Defaults {
+			parent, toField := makeFieldPath(out, field.Path)
+			if parent == nil || parent.HasField(toField) {
+				continue
+			}
+			if value := c.mapping.defaultValue(parent.GetMessageDescriptor(), toField, field); value != nil {
+				if err := parent.MergeFrom(value); err != nil {
+					c.fail(nil, toField)
+				}
+			}
+		}
+	}
+	copyUnknownFields(in, out)
+	return out, valid
+}
+
+// fieldPairs returns the field of toDesc with the same name as each field of
+// fromDesc, or nil if it was removed.
+func (m *Mapping) fieldPairs(fromDesc, toDesc *desc.MessageDescriptor) []*desc.FieldDescriptor {
+	key := [2]*desc.MessageDescriptor{fromDesc, toDesc}
+	if pairs, ok := m.fieldPairCache.Load(key); ok {
+		return pairs.([]*desc.FieldDescriptor)
+	}
+	fields := fromDesc.GetFields()
+	pairs := make([]*desc.FieldDescriptor, len(fields))
+	for i, fd := range fields {
+		pairs[i] = toDesc.FindFieldByName(fd.GetName())
+	}
+	m.fieldPairCache.Store(key, pairs)
+	return pairs
+}
+
+type defaultKey struct {
+	parent *desc.MessageDescriptor
+	field  *FieldDefault
+}
+
+// defaultValue returns a message of parent holding only the default value of
+// the field, or nil if the value is invalid.
+func (m *Mapping) defaultValue(parent *desc.MessageDescriptor, toField *desc.FieldDescriptor, field *FieldDefault) *dynamic.Message {
+	key := defaultKey{parent, field}
+	if value, ok := m.defaultCache.Load(key); ok {
+		return value.(*dynamic.Message)
+	}
+	value := dynamic.NewMessage(parent)
+	p := []byte(fmt.Sprintf(`{%q:%s}`, toField.GetJSONName(), field.Value))
+	if err := value.UnmarshalJSON(p); err != nil {
+		logger.Warn().Err(err).Msgf("Invalid default for %v of %s", field.Path, parent.GetFullyQualifiedName())
+		value = nil
+	}
+	m.defaultCache.Store(key, value)
+	return value
+}
+
+func (c *Converter) set(out *dynamic.Message, toField *desc.FieldDescriptor, value any) {
+	if err := out.TrySetField(toField, value); err != nil {
+		logger.Debug().Err(err).Msgf("Failed to set field %s", toField.GetFullyQualifiedName())
+		c.fail(nil, toField)
+	}
+}
+
+func (c *Converter) field(rules *MessageRules, fromField, toField *desc.FieldDescriptor, value any) (any, bool) {
+	if fromField.IsMap() || toField.IsMap() {
+		if !fromField.IsMap() || !toField.IsMap() {
+			return c.fail(fromField, toField)
+		}
+		entries, ok := value.(map[any]any)
+		if !ok {
+			return c.fail(fromField, toField)
+		}
+		fromKey, toKey := fromField.GetMapKeyType(), toField.GetMapKeyType()
+		fromValue, toValue := fromField.GetMapValueType(), toField.GetMapValueType()
+		out := make(map[any]any, len(entries))
+		for k, v := range entries {
+			if k, ok = c.single(nil, fromKey, toKey, k); !ok {
+				continue
+			}
+			if v, ok = c.single(nil, fromValue, toValue, v); !ok {
+				continue
+			}
+			out[k] = v
+		}
+		return out, true
+	}
+	if fromField.IsRepeated() {
+		values, ok := value.([]any)
+		if !ok {
+			return c.fail(fromField, toField)
+		}
+		if !toField.IsRepeated() {
+			// Only the first element survives in a singular field.
+			if len(values) == 0 {
+				return nil, false
+			}
+			if len(values) > 1 {
+				c.fail(fromField, toField)
+			}
+			return c.single(rules, fromField, toField, values[0])
+		}
+		out := make([]any, 0, len(values))
+		for _, v := range values {
+			if v, ok = c.single(rules, fromField, toField, v); ok {
+				out = append(out, v)
+			}
+		}
+		return out, true
+	}
+	value, ok := c.single(rules, fromField, toField, value)
+	if ok && toField.IsRepeated() {
+		return []any{value}, true
+	}
+	return value, ok
+}
+
+func (c *Converter) single(rules *MessageRules, fromField, toField *desc.FieldDescriptor, value any) (any, bool) {
+	fromMessage, toMessage := fromField.GetMessageType(), toField.GetMessageType()
+	if rules != nil {
+		if inner, ok := rules.Wraps[fromField.GetName()]; ok && toMessage != nil {
+			return c.wrap(fromField, toMessage, inner, value)
+		}
+		if inner, ok := rules.Unwraps[toField.GetName()]; ok && fromMessage != nil {
+			return c.unwrap(fromMessage, toField, inner, value)
+		}
+	}
+	if fromMessage == nil && toMessage == nil {
+		return c.scalar(fromField, toField, value)
+	}
+	if fromMessage == nil || toMessage == nil {
+		return c.fail(fromField, toField)
+	}
+	in, ok := asDynamicMessage(value)
+	if !ok {
+		return c.fail(fromField, toField)
+	}
+	if c.mapping.messageEqual[[2]*desc.MessageDescriptor{fromMessage, toMessage}] &&
+		fromMessage.GetFullyQualifiedName() == toMessage.GetFullyQualifiedName() {
+		// Same schema, the value is marshaled the same in both protocols.
+		return in, true
+	}
+	if fromMessage.GetName() != toMessage.GetName() {
+		// A message wrapped into or unwrapped from a new submessage.
+		for _, fd := range toMessage.GetFields() {
+			if m := fd.GetMessageType(); m != nil && !fd.IsRepeated() && m.GetName() == fromMessage.GetName() {
+				return c.wrap(fromField, toMessage, fd.GetName(), value)
+			}
+		}
+		for _, fd := range fromMessage.GetFields() {
+			if m := fd.GetMessageType(); m != nil && !fd.IsRepeated() && m.GetName() == toMessage.GetName() {
+				return c.unwrap(fromMessage, toField, fd.GetName(), value)
+			}
+		}
+	}
+	out, ok := c.message(in, toMessage)
+	if !ok {
+		logger.Debug().Msgf("Dropping %s holding a payload that cannot be converted", strings.Join(c.path, "."))
+		c.drop()
+		return nil, false
+	}
+	return out, true
+}
+
+// embedded converts the serialized messages of an embedded field, the
+// message is told by the registry.
+func (c *Converter) embedded(e *EmbeddedField, in *dynamic.Message, fromField, toField *desc.FieldDescriptor) (any, bool) {
+	if fromField.IsMap() || toField.IsMap() || fromField.GetType() != toField.GetType() {
+		return c.fail(fromField, toField)
+	}
+	name := e.Payload
+	if e.Type != "" {
+		typeField := in.GetMessageDescriptor().FindFieldByName(e.Type)
+		if typeField == nil {
+			return c.fail(fromField, toField)
+		}
+		id, ok := coerceUint(in.GetField(typeField), 32)
+		if !ok {
+			return c.fail(fromField, toField)
+		}
+		name = c.mapping.payloadTable(e.Table).Message(c.from, uint32(id))
+	}
+	if c.mapping.SchemaEqual(c.from, c.to, name) {
+		return c.field(nil, fromField, toField, in.GetField(fromField))
+	}
+	fromDesc, toDesc := c.mapping.MessageDescMap[c.from][name], c.mapping.MessageDescMap[c.to][name]
+	if fromDesc == nil || toDesc == nil {
+		return c.fail(fromField, toField)
+	}
+	convert := func(value any) (any, bool) {
+		data, ok := value.([]byte)
+		if !ok {
+			return c.fail(fromField, toField)
+		}
+		payload := dynamic.NewMessage(fromDesc)
+		if err := payload.Unmarshal(data); err != nil {
+			return c.fail(fromField, toField)
+		}
+		out, ok := c.message(payload, toDesc)
+		if !ok {
+			return nil, false
+		}
+		data, err := out.Marshal()
+		if err != nil {
+			return c.fail(fromField, toField)
+		}
+		return data, true
+	}
+	if !fromField.IsRepeated() {
+		return convert(in.GetField(fromField))
+	}
+	values, _ := in.GetField(fromField).([]any)
+	out := make([]any, 0, len(values))
+	for _, value := range values {
+		if value, ok := convert(value); ok {
+			out = append(out, value)
+		}
+	}
+	return out, true
+}
+
+// payloadType translates the id choosing the message of an embedded payload
+// to the id of the same message in the target protocol.
+func (c *Converter) payloadType(e *EmbeddedField, fromField, toField *desc.FieldDescriptor, value any) (any, bool) {
+	if fromField.IsRepeated() || toField.IsRepeated() || toField.GetMessageType() != nil {
+		return c.fail(fromField, toField)
+	}
+	id, ok := coerceUint(value, 32)
+	if !ok {
+		return c.fail(fromField, toField)
+	}
+	translated, ok := c.mapping.payloadTable(e.Table).Translate(c.from, c.to, uint32(id))
+	if !ok {
+		return c.fail(fromField, toField)
+	}
+	if toField.GetEnumType() != nil {
+		return int32(translated), true
+	}
+	if value, ok = coerceScalar(toField, translated); !ok {
+		return c.fail(fromField, toField)
+	}
+	return value, true
+}
+
+func (c *Converter) wrap(fromField *desc.FieldDescriptor, toMessage *desc.MessageDescriptor, inner string, value any) (any, bool) {
+	toInner := findField(toMessage, inner)
+	if toInner == nil || toInner.IsMap() {
+		return c.fail(fromField, nil)
+	}
+	value, ok := c.single(nil, fromField, toInner, value)
+	if !ok {
+		return nil, false
+	}
+	if toInner.IsRepeated() {
+		value = []any{value}
+	}
+	out := dynamic.NewMessage(toMessage)
+	c.set(out, toInner, value)
+	return out, true
+}
+
+func (c *Converter) unwrap(fromMessage *desc.MessageDescriptor, toField *desc.FieldDescriptor, inner string, value any) (any, bool) {
+	fromInner := findField(fromMessage, inner)
+	if fromInner == nil || fromInner.IsRepeated() {
+		return c.fail(nil, toField)
+	}
+	in, ok := asDynamicMessage(value)
+	if !ok || !in.HasField(fromInner) {
+		return nil, false
+	}
+	return c.single(nil, fromInner, toField, in.GetField(fromInner))
+}
+
+func (c *Converter) drop(path ...string) {
+	c.dropped = append(c.dropped, strings.Join(append(c.path[:len(c.path):len(c.path)], path...), "."))
+}
+
+func (c *Converter) fail(fromField, toField *desc.FieldDescriptor) (any, bool) {
+	c.unreconciled = append(c.unreconciled, fmt.Sprintf("%s (%s to %s)",
+		strings.Join(c.path, "."), FieldTypeName(fromField), FieldTypeName(toField),
+	))
+	return nil, false
+}
+
+func asDynamicMessage(value any) (*dynamic.Message, bool) {
+	switch v := value.(type) {
+	case *dynamic.Message:
+		return v, v != nil
+	case proto.Message:
+		m, err := dynamic.AsDynamicMessage(v)
+		return m, err == nil
+	}
+	return nil, false
+}
+
+// copyUnknownFields keeps the fields unknown to both descriptors, as they
+// cannot be misread by the target.
+func copyUnknownFields(in, out *dynamic.Message) {
+	tags := in.GetUnknownFields()
+	if len(tags) == 0 {
+		return
+	}
+	b := codec.NewBuffer(nil)
+	for _, tag := range tags {
+		if out.GetMessageDescriptor().FindFieldByNumber(tag) != nil {
+			continue
+		}
+		for _, u := range in.GetUnknownField(tag) {
+			_ = b.EncodeTagAndWireType(tag, u.Encoding)
+			switch u.Encoding {
+			case proto.WireBytes:
+				_ = b.EncodeRawBytes(u.Contents)
+			case proto.WireStartGroup:
+				_, _ = b.Write(u.Contents)
+				_ = b.EncodeTagAndWireType(tag, proto.WireEndGroup)
+			case proto.WireFixed32:
+				_ = b.EncodeFixed32(u.Value)
+			case proto.WireFixed64:
+				_ = b.EncodeFixed64(u.Value)
+			case proto.WireVarint:
+				_ = b.EncodeVarint(u.Value)
+			}
+		}
+	}
+	if err := out.UnmarshalMerge(b.Bytes()); err != nil {
+		logger.Debug().Err(err).Msgf("Failed to copy unknown fields of %s", in.GetMessageDescriptor().GetFullyQualifiedName())
+	}
+}
+
+// findField looks up a field by its proto name or its JSON name.
+func findField(d *desc.MessageDescriptor, name string) *desc.FieldDescriptor {
+	if fd := d.FindFieldByName(name); fd != nil {
+		return fd
+	}
+	return d.FindFieldByJSONName(name)
+}
+
+func findFieldPath(d *desc.MessageDescriptor, path []string) (*desc.FieldDescriptor, bool) {
+	var fd *desc.FieldDescriptor
+	for i, name := range path {
+		if d == nil {
+			return nil, false
+		}
+		if fd = findField(d, name); fd == nil {
+			return nil, false
+		}
+		if i < len(path)-1 && (fd.IsRepeated() || fd.IsMap()) {
+			return nil, false
+		}
+		d = fd.GetMessageType()
+	}
+	return fd, fd != nil
+}
+
+// takeFieldPath clears the field at path in m, returning its descriptor and
+// its value.
+func takeFieldPath(m *dynamic.Message, path []string) (*desc.FieldDescriptor, any, bool) {
+	for i, name := range path {
+		fd := findField(m.GetMessageDescriptor(), name)
+		if fd == nil || !m.HasField(fd) {
+			return nil, nil, false
+		}
+		if i == len(path)-1 {
+			value := m.GetField(fd)
+			m.ClearField(fd)
+			return fd, value, true
+		}
+		if fd.IsRepeated() || fd.IsMap() {
+			return nil, nil, false
+		}
+		next, ok := asDynamicMessage(m.GetField(fd))
+		if !ok {
+			return nil, nil, false
+		}
+		m = next
+	}
+	return nil, nil, false
+}
+
+// makeFieldPath returns the message holding the field at path in m and the
+// descriptor of the field, creating the intermediate messages if necessary.
+func makeFieldPath(m *dynamic.Message, path []string) (*dynamic.Message, *desc.FieldDescriptor) {
+	for i, name := range path {
+		fd := findField(m.GetMessageDescriptor(), name)
+		if fd == nil {
+			return nil, nil
+		}
+		if i == len(path)-1 {
+			return m, fd
+		}
+		if fd.IsRepeated() || fd.IsMap() || fd.GetMessageType() == nil {
+			return nil, nil
+		}
+		if m.HasField(fd) {
+			next, ok := asDynamicMessage(m.GetField(fd))
+			if !ok {
+				return nil, nil
+			}
+			m = next
+			continue
+		}
+		next := dynamic.NewMessage(fd.GetMessageType())
+		m.SetField(fd, next)
+		m = next
+	}
+	return nil, nil
+}
@@ -0,0 +1,176 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// The options of the JSON round trip the direct conversion replaced.
+var (
+	testMarshalOptions   = &jsonpb.Marshaler{EnumsAsInts: true}
+	testUnmarshalOptions = &jsonpb.Unmarshaler{AllowUnknownFields: true}
+)
+
+// newConvertTestMapping returns two protocols differing in the integer
+// widths only, so that the JSON round trip converts them losslessly.
+func newConvertTestMapping(tb testing.TB) *Mapping {
+	scene := func(narrow, wide string) string {
+		return `syntax = "proto3";
+import "Vector.proto";
+enum State { STATE_NONE = 0; STATE_IDLE = 1; STATE_MOVE = 2; }
+message SceneNotify {
+  ` + narrow + ` changed = 1;
+  repeated Entity entities = 2;
+  map<uint32, Prop> props = 3;
+  map<string, Vector> points = 4;
+  oneof detail {
+    Vector pos = 5;
+    string name = 6;
+    Entity owner = 7;
+  }
+  State state = 8;
+  repeated uint32 ids = 9;
+  message Prop { uint32 type = 1; ` + wide + ` ival = 2; float fval = 3; }
+  message Entity { ` + narrow + ` id = 1; Vector pos = 2; repeated Prop props = 3; bytes data = 4; State state = 5; }
+}`
+	}
+	vector := `syntax = "proto3";
+message Vector { float x = 1; float y = 2; float z = 3; }`
+	return newTestMapping(tb, "v1", map[Protocol]map[string]string{
+		"v1": {
+			"protocol.csv":               "SceneNotify,10\n",
+			"arguments.json":             `{"ability": [], "combat": []}`,
+			"protocol/Vector.proto":      vector,
+			"protocol/SceneNotify.proto": scene("uint32", "int64"),
+		},
+		"v2": {
+			"protocol.csv":               "SceneNotify,20\n",
+			"arguments.json":             `{"ability": [], "combat": []}`,
+			"protocol/Vector.proto":      vector,
+			"protocol/SceneNotify.proto": scene("uint64", "int32"),
+		},
+	})
+}
+
+var convertTests = []struct {
+	name string
+	in   string
+}{
+	{"empty", `{}`},
+	{"scalars", `{"changed":7,"state":2,"ids":[1,2,3]}`},
+	{"nested", `{"entities":[{"id":1,"pos":{"x":1.5},"props":[{"type":1,"ival":"5"}],"data":"AQI=","state":1},{"id":2}]}`},
+	{"maps", `{"props":{"1":{"type":2,"fval":0.5},"2":{}},"points":{"a":{"y":2},"b":{}}}`},
+	{"oneof message", `{"pos":{"z":-1}}`},
+	{"oneof scalar", `{"name":"abc"}`},
+	{"oneof nested", `{"owner":{"id":3,"props":[{"ival":"-9"}]}}`},
+	{"all", `{"changed":1,"entities":[{"id":1,"pos":{"x":1},"props":[{"type":1,"ival":"2","fval":3}],"data":"AQ==","state":2}],` +
+		`"props":{"7":{"type":1}},"points":{"p":{"x":1,"y":2,"z":3}},"owner":{"id":4},"state":1,"ids":[4,5]}`},
+}
+
+func convertJSON(m *Mapping, from, to Protocol, in *dynamic.Message) (*dynamic.Message, error) {
+	js, err := in.MarshalJSONPB(testMarshalOptions)
+	if err != nil {
+		return nil, err
+	}
+	out := dynamic.NewMessage(m.MessageDescMap[to][in.GetMessageDescriptor().GetName()])
+	if err := out.UnmarshalJSONPB(testUnmarshalOptions, js); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func TestConvertMatchesJSON(t *testing.T) {
+	m := newConvertTestMapping(t)
+	for _, tt := range convertTests {
+		for _, pair := range [][2]Protocol{{"v1", "v2"}, {"v2", "v1"}} {
+			from, to := pair[0], pair[1]
+			t.Run(tt.name+" "+string(from)+" to "+string(to), func(t *testing.T) {
+				in := newTestMessage(t, m, from, "SceneNotify", tt.in)
+				want, err := convertJSON(m, from, to, in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c := m.NewConverter(from, to)
+				got := c.Convert(in, m.MessageDescMap[to]["SceneNotify"])
+				if !dynamic.Equal(got, want) {
+					g, _ := got.MarshalJSON()
+					w, _ := want.MarshalJSON()
+					t.Errorf("got %s\nwant %s", g, w)
+				}
+				if len(c.Unreconciled()) > 0 || len(c.Dropped()) > 0 {
+					t.Errorf("unreconciled %v, dropped %v", c.Unreconciled(), c.Dropped())
+				}
+			})
+		}
+	}
+}
+
+func TestConvertKeepsUnknownFields(t *testing.T) {
+	m := newConvertTestMapping(t)
+	in := newTestMessage(t, m, "v1", "SceneNotify", `{"changed":1,"entities":[{"id":1}]}`)
+	// The fields 15 of the notify and 16 of the entity are known to neither
+	// protocol.
+	if err := in.UnmarshalMerge([]byte{15 << 3, 42}); err != nil {
+		t.Fatal(err)
+	}
+	entity := in.GetFieldByName("entities").([]any)[0].(*dynamic.Message)
+	if err := entity.UnmarshalMerge([]byte{0x80, 0x01, 7}); err != nil {
+		t.Fatal(err)
+	}
+	out := m.NewConverter("v1", "v2").Convert(in, m.MessageDescMap["v2"]["SceneNotify"])
+	data, err := out.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := dynamic.NewMessage(m.MessageDescMap["v1"]["SceneNotify"])
+	if err := back.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if tags := back.GetUnknownFields(); len(tags) != 1 || tags[0] != 15 {
+		t.Errorf("unknown fields %v, want [15]", tags)
+	}
+	entity = back.GetFieldByName("entities").([]any)[0].(*dynamic.Message)
+	if tags := entity.GetUnknownFields(); len(tags) != 1 || tags[0] != 16 {
+		t.Errorf("unknown fields of the entity %v, want [16]", tags)
+	}
+}
+
+func benchmarkConvert(b *testing.B, convert func(m *Mapping, in *dynamic.Message) (*dynamic.Message, error)) {
+	m := newConvertTestMapping(b)
+	var samples [][]byte
+	for _, tt := range convertTests {
+		samples = append(samples, marshalTestMessage(b, m, "v1", "SceneNotify", tt.in))
+	}
+	fromDesc := m.MessageDescMap["v1"]["SceneNotify"]
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, data := range samples {
+			in := dynamic.NewMessage(fromDesc)
+			if err := in.Unmarshal(data); err != nil {
+				b.Fatal(err)
+			}
+			out, err := convert(m, in)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := out.Marshal(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkConvertJSON(b *testing.B) {
+	benchmarkConvert(b, func(m *Mapping, in *dynamic.Message) (*dynamic.Message, error) {
+		return convertJSON(m, "v1", "v2", in)
+	})
+}
+
+func BenchmarkConvertDirect(b *testing.B) {
+	benchmarkConvert(b, func(m *Mapping, in *dynamic.Message) (*dynamic.Message, error) {
+		return m.NewConverter("v1", "v2").Convert(in, m.MessageDescMap["v2"]["SceneNotify"]), nil
+	})
+}
@@ -0,0 +1,312 @@
+package mapper
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// descriptorCacheVersion is hashed with the sources, to drop the caches
+// written by another layout.
+const descriptorCacheVersion = "1"
+
+// protoFiles are the compiled proto files of a protocol, linked together so
+// that the messages shared by several commands are the same descriptors.
+type protoFiles struct {
+	files   map[string]*desc.FileDescriptor
+	errs    map[string]error
+	sources map[string]bool
+}
+
+// find returns the compiled file, or the error it failed to compile with.
+func (f *protoFiles) find(file string) (*desc.FileDescriptor, error) {
+	if fd := f.files[file]; fd != nil {
+		return fd, nil
+	}
+	if err := f.errs[file]; err != nil {
+		return nil, err
+	}
+	if f.sources[file] {
+		return nil, fmt.Errorf("%s failed to compile", file)
+	}
+	return nil, fmt.Errorf("%s: %w", file, fs.ErrNotExist)
+}
+
+func (f *protoFiles) has(file string) bool {
+	return f.files[file] != nil
+}
+
+// names returns the names of the compiled files, sorted.
+func (f *protoFiles) names() []string {
+	names := make([]string, 0, len(f.files))
+	for name := range f.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadProtoFiles loads the descriptor bundle of a protocol, or compiles every
+// proto file of data/mapping/{{ VERSION }}/protocol. The compiled files of a
+// directory are cached in data/mapping/{{ VERSION }}/.cache/{{ HASH }}.pb, the
+// FileDescriptorSet written by the last compilation of the same sources if
+// every file compiled.
+func loadProtoFiles(v Protocol, src *protocolSource) (*protoFiles, error) {
+	if bundle, err := fs.ReadFile(src, bundleFile); err == nil {
+		files, err := readDescriptorSet(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", src.path(bundleFile), err)
+		}
+		logger.Info().Msgf("Loaded %d proto files of %s from %s", len(files.files), v, src.path(bundleFile))
+		return files, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", src.path(bundleFile), err)
+	}
+	protocolFS, err := fs.Sub(src, "protocol")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(protocolFS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protocol dir: %w", err)
+	}
+	var sources []string
+	sourceSet := make(map[string]bool)
+	h := sha256.New()
+	h.Write([]byte(descriptorCacheVersion))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".proto") {
+			continue
+		}
+		data, err := fs.ReadFile(protocolFS, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+		writeHashed(h, []byte(entry.Name()))
+		writeHashed(h, data)
+		sources = append(sources, entry.Name())
+		sourceSet[entry.Name()] = true
+	}
+	var cacheDir, cacheFile string
+	if src.dir != "" {
+		cacheDir = path.Join(src.dir, ".cache")
+		cacheFile = path.Join(cacheDir, hex.EncodeToString(h.Sum(nil))+".pb")
+		if files, err := readDescriptorCache(cacheFile); err == nil {
+			files.sources = sourceSet
+			logger.Info().Msgf("Loaded %d proto files of %s from %s", len(files.files), v, cacheFile)
+			return files, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			logger.Warn().Err(err).Msgf("Failed to read descriptor cache of %s", v)
+		}
+	}
+	start := time.Now()
+	files, err := compileProtoFiles(protocolFS, sources)
+	if err != nil {
+		return nil, err
+	}
+	files.sources = sourceSet
+	logger.Info().Msgf("Compiled %d proto files of %s in %s", len(files.files), v, time.Since(start))
+	if len(files.errs) > 0 {
+		// The cache holds no errors, the sources are compiled again until
+		// they are fixed.
+		logger.Warn().Msgf("Failed to compile %d proto files of %s, the descriptors are not cached", len(files.errs), v)
+		return files, nil
+	}
+	if cacheFile == "" {
+		return files, nil
+	}
+	if err := writeDescriptorCache(cacheDir, cacheFile, files); err != nil {
+		logger.Warn().Err(err).Msgf("Failed to write descriptor cache of %s", v)
+	}
+	return files, nil
+}
+
+// writeHashed writes the data with its length, so that the data written one
+// after the other hash differently once split differently.
+func writeHashed(h hash.Hash, data []byte) {
+	binary.Write(h, binary.BigEndian, uint64(len(data)))
+	h.Write(data)
+}
+
+// compileProtoFiles compiles the sources in as many chunks as cores, the
+// chunks failing to compile are split until the broken files are found.
+func compileProtoFiles(fsys fs.FS, sources []string) (*protoFiles, error) {
+	workers := runtime.GOMAXPROCS(0)
+	size := (len(sources) + workers - 1) / workers
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+	errs := make(map[string]error)
+	for i := 0; i < len(sources); i += size {
+		end := i + size
+		if end > len(sources) {
+			end = len(sources)
+		}
+		chunk := sources[i:end]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parser := &protoparse.Parser{Accessor: func(name string) (io.ReadCloser, error) {
+				return fsys.Open(name)
+			}}
+			compiled, failed := compileChunk(parser, chunk)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, fd := range compiled {
+				addFileProtos(protos, fd)
+			}
+			for file, err := range failed {
+				errs[file] = err
+			}
+		}()
+	}
+	wg.Wait()
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fdp := range protos {
+		set.File = append(set.File, fdp)
+	}
+	files := &protoFiles{files: make(map[string]*desc.FileDescriptor), errs: errs}
+	if len(set.File) == 0 {
+		return files, nil
+	}
+	var err error
+	files.files, err = desc.CreateFileDescriptorsFromSet(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link proto files: %w", err)
+	}
+	return files, nil
+}
+
+func compileChunk(parser *protoparse.Parser, files []string) ([]*desc.FileDescriptor, map[string]error) {
+	fds, err := parser.ParseFiles(files...)
+	if err == nil {
+		return fds, nil
+	}
+	if len(files) == 1 {
+		return nil, map[string]error{files[0]: err}
+	}
+	half := len(files) / 2
+	fds, errs := compileChunk(parser, files[:half])
+	more, moreErrs := compileChunk(parser, files[half:])
+	for file, err := range moreErrs {
+		if errs == nil {
+			errs = make(map[string]error)
+		}
+		errs[file] = err
+	}
+	return append(fds, more...), errs
+}
+
+// addFileProtos adds the file and its imports, the well-known protos are
+// added too as the set must be complete.
+func addFileProtos(protos map[string]*descriptorpb.FileDescriptorProto, fd *desc.FileDescriptor) {
+	if protos[fd.GetName()] != nil {
+		return
+	}
+	protos[fd.GetName()] = fd.AsFileDescriptorProto()
+	for _, dep := range fd.GetDependencies() {
+		addFileProtos(protos, dep)
+	}
+}
+
+func readDescriptorCache(file string) (*protoFiles, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	files, err := readDescriptorSet(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", file, err)
+	}
+	return files, nil
+}
+
+// readDescriptorSet links the files of a serialized FileDescriptorSet.
+func readDescriptorSet(data []byte) (*protoFiles, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	files := &protoFiles{files: make(map[string]*desc.FileDescriptor)}
+	if len(set.File) == 0 {
+		return files, nil
+	}
+	var err error
+	files.files, err = desc.CreateFileDescriptorsFromSet(set)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// writeDescriptorCache writes the compiled files and removes the caches of
+// the previous sources.
+func writeDescriptorCache(dir, file string, files *protoFiles) error {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range files.names() {
+		set.File = append(set.File, files.files[name].AsFileDescriptorProto())
+	}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	stale, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, entry := range stale {
+		if isDescriptorCache(entry.Name()) {
+			if err := os.Remove(path.Join(dir, entry.Name())); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to remove the previous caches: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// isDescriptorCache tells if the file is named as a cache, by the hash of
+// its sources.
+func isDescriptorCache(name string) bool {
+	hash, ok := strings.CutSuffix(name, ".pb")
+	if !ok {
+		hash, ok = strings.CutSuffix(name, ".pb.tmp")
+	}
+	if !ok || len(hash) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
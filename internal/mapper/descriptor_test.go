@@ -0,0 +1,205 @@
+package mapper
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// cacheFiles returns the descriptor caches of the protocol directory.
+func cacheFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(dir, ".cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if isDescriptorCache(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func loadTestProtoFiles(t *testing.T, dir string) *protoFiles {
+	t.Helper()
+	src, err := openProtocol(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := loadProtoFiles("v1", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestDescriptorCache(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"protocol/Vector.proto":     "syntax = \"proto3\";\nmessage Vector { float x = 1; }",
+		"protocol/MoveNotify.proto": "syntax = \"proto3\";\nimport \"Vector.proto\";\nmessage MoveNotify { Vector pos = 1; }",
+		"protocol/PingReq.proto":    "syntax = \"proto3\";\nmessage PingReq { uint32 seq = 1; }",
+		"protocol/README.md":        "not a proto file",
+		".cache/notes.pb":           "not a cache",
+		".cache/keep.txt":           "not a cache",
+	})
+
+	files := loadTestProtoFiles(t, dir)
+	want := []string{"MoveNotify.proto", "PingReq.proto", "Vector.proto"}
+	if got := files.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("compiled %v, want %v", got, want)
+	}
+	caches := cacheFiles(t, dir)
+	if len(caches) != 1 {
+		t.Fatalf("caches %v, want one", caches)
+	}
+	cache := filepath.Join(dir, ".cache", caches[0])
+
+	// The same sources load the cache, written here with PingReq alone.
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{files.files["PingReq.proto"].AsFileDescriptorProto()}}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cache, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files = loadTestProtoFiles(t, dir)
+	if got := files.names(); len(got) != 1 || got[0] != "PingReq.proto" {
+		t.Fatalf("loaded %v, want the cached PingReq.proto", got)
+	}
+	fd, err := files.find("PingReq.proto")
+	if err != nil || fd.FindMessage("PingReq") == nil {
+		t.Fatalf("cached PingReq.proto: %v", err)
+	}
+
+	// Other sources are compiled again, and replace the previous cache but
+	// not the other files.
+	writeTestFiles(t, dir, map[string]string{
+		"protocol/PingReq.proto": "syntax = \"proto3\";\nmessage PingReq { uint32 seq = 1; uint64 time = 2; }",
+	})
+	files = loadTestProtoFiles(t, dir)
+	if len(files.names()) != 3 {
+		t.Fatalf("compiled %v, want 3 files", files.names())
+	}
+	if caches = cacheFiles(t, dir); len(caches) != 1 || filepath.Join(dir, ".cache", caches[0]) == cache {
+		t.Fatalf("caches %v, want one other than %s", caches, cache)
+	}
+	cache = filepath.Join(dir, ".cache", caches[0])
+	for _, name := range []string{"notes.pb", "keep.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, ".cache", name)); err != nil {
+			t.Errorf("removed %s: %v", name, err)
+		}
+	}
+
+	// The sources with a broken file are not cached, the errors are the
+	// same on every load.
+	writeTestFiles(t, dir, map[string]string{
+		"protocol/BrokenNotify.proto": "syntax = \"proto3\";\nmessage BrokenNotify { Missing m = 1; }",
+	})
+	for i := 0; i < 2; i++ {
+		files = loadTestProtoFiles(t, dir)
+		if len(files.names()) != 3 {
+			t.Errorf("load %d: compiled %v, want 3 files", i, files.names())
+		}
+		if _, err := files.find("BrokenNotify.proto"); err == nil || !strings.Contains(err.Error(), "Missing") {
+			t.Errorf("load %d: error %v, want the compile error", i, err)
+		}
+		if caches = cacheFiles(t, dir); len(caches) != 1 || filepath.Join(dir, ".cache", caches[0]) != cache {
+			t.Errorf("load %d: caches %v, want only %s", i, caches, cache)
+		}
+	}
+}
+
+func TestCompileChunk(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Vector.proto":      {Data: []byte("syntax = \"proto3\";\nmessage Vector { float x = 1; }")},
+		"MoveNotify.proto":  {Data: []byte("syntax = \"proto3\";\nimport \"Vector.proto\";\nmessage MoveNotify { Vector pos = 1; }")},
+		"PingReq.proto":     {Data: []byte("syntax = \"proto3\";\nmessage PingReq { uint32 seq = 1; }")},
+		"PingRsp.proto":     {Data: []byte("syntax = \"proto3\";\nmessage PingRsp { uint32 seq = 1; }")},
+		"Syntax.proto":      {Data: []byte("syntax = \"proto3\";\nmessage Syntax { uint32 seq = 1 }")},
+		"Import.proto":      {Data: []byte("syntax = \"proto3\";\nimport \"Gone.proto\";\nmessage Import {}")},
+		"SceneNotify.proto": {Data: []byte("syntax = \"proto3\";\nimport \"Vector.proto\";\nmessage SceneNotify { repeated Vector points = 1; }")},
+	}
+	sources := []string{"Vector.proto", "MoveNotify.proto", "Syntax.proto", "PingReq.proto", "PingRsp.proto", "Import.proto", "SceneNotify.proto"}
+	parser := &protoparse.Parser{Accessor: func(name string) (io.ReadCloser, error) {
+		return fsys.Open(name)
+	}}
+	compiled, errs := compileChunk(parser, sources)
+	var names []string
+	for _, fd := range compiled {
+		names = append(names, fd.GetName())
+	}
+	sort.Strings(names)
+	if want := "MoveNotify.proto,PingReq.proto,PingRsp.proto,SceneNotify.proto,Vector.proto"; strings.Join(names, ",") != want {
+		t.Errorf("compiled %v, want %s", names, want)
+	}
+	if len(errs) != 2 || errs["Syntax.proto"] == nil || errs["Import.proto"] == nil {
+		t.Errorf("errors %v, want those of Syntax.proto and Import.proto", errs)
+	}
+
+	// The chunks compiled apart are linked together.
+	files, err := compileProtoFiles(fsys, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	move, err := files.find("MoveNotify.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene, err := files.find("SceneNotify.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := move.FindMessage("MoveNotify").FindFieldByName("pos").GetMessageType()
+	b := scene.FindMessage("SceneNotify").FindFieldByName("points").GetMessageType()
+	if a != b {
+		t.Error("the messages shared by two files are not the same descriptor")
+	}
+	if len(files.errs) != 2 {
+		t.Errorf("errors %v, want 2", files.errs)
+	}
+}
+
+func TestIsDescriptorCache(t *testing.T) {
+	hash := strings.Repeat("0123456789abcdef", 4)
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{hash + ".pb", true},
+		{hash + ".pb.tmp", true},
+		{hash, false},
+		{hash[1:] + ".pb", false},
+		{strings.Repeat("x", 64) + ".pb", false},
+		{"protocol.pb", false},
+	}
+	for _, tt := range tests {
+		if got := isDescriptorCache(tt.name); got != tt.want {
+			t.Errorf("isDescriptorCache(%s) = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
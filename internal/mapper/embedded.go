@@ -0,0 +1,157 @@
+package mapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// The tables choosing the message of an embedded payload by the id held in
+// a sibling field.
+const (
+	PayloadTableAbility = "ability" // AbilityInvokeArgument
+	PayloadTableCombat  = "combat"  // CombatTypeArgument
+	PayloadTableCommand = "command" // The command ids
+)
+
+// EmbeddedField is a bytes field of Message holding a serialized message,
+// either Payload or the one chosen by the id in the sibling field Type
+// through Table.
+type EmbeddedField struct {
+	Message string `json:"message"`
+	Field   string `json:"field"`
+	Payload string `json:"payload,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Table   string `json:"table,omitempty"`
+}
+
+// EmbeddedFields is the default registry, in the base protocol names.
+var EmbeddedFields = []*EmbeddedField{
+	{Message: "UnionCmd", Field: "body", Type: "message_id", Table: PayloadTableCommand},
+	{Message: "AbilityInvokeEntry", Field: "ability_data", Type: "argument_type", Table: PayloadTableAbility},
+	{Message: "CombatInvokeEntry", Field: "combat_data", Type: "argument_type", Table: PayloadTableCombat},
+}
+
+// loadEmbedded builds the embedded field registry of a protocol from the
+// default registry and data/mapping/{{ VERSION }}/embedded.json, whose entries
+// are named as in the protocol and replace the defaults of the same field.
+func (m *Mapping) loadEmbedded(files *protoFiles, v Protocol, src *protocolSource) error {
+	var fields []*EmbeddedField
+	file := src.path("embedded.json")
+	data, err := fs.ReadFile(src, "embedded.json")
+	if err == nil {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return fmt.Errorf("failed to parse embedded fields %s: %w", file, err)
+		}
+		logger.Info().Msgf("Loaded %d embedded fields in %s", len(fields), v)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read embedded fields %s: %w", file, err)
+	}
+	registry := make(map[string][]*EmbeddedField)
+	for _, e := range fields {
+		if e.Message == "" || e.Field == "" || (e.Payload == "") == (e.Type == "") {
+			return fmt.Errorf("invalid embedded field %s.%s in %s", e.Message, e.Field, file)
+		}
+		if e.Type != "" && m.payloadTable(e.Table) == nil {
+			return fmt.Errorf("unknown payload table %q of %s.%s in %s", e.Table, e.Message, e.Field, file)
+		}
+		if e.Payload != "" {
+			e.Payload = m.CanonicalName(v, e.Payload)
+		}
+		registry[e.Message] = append(registry[e.Message], e)
+	}
+	for _, d := range EmbeddedFields {
+		e := *d
+		e.Message = m.LocalName(v, d.Message)
+		if findEmbeddedField(registry[e.Message], e.Field) == nil {
+			registry[e.Message] = append(registry[e.Message], &e)
+		}
+	}
+	m.EmbeddedFieldMap[v] = registry
+	for _, fields := range registry {
+		for _, e := range fields {
+			if e.Payload == "" || m.MessageDescMap[v][e.Payload] != nil {
+				continue
+			}
+			local := m.LocalName(v, e.Payload)
+			if err := m.parseMessageDesc(files, v, local, local+".proto"); err != nil {
+				logger.Warn().Err(err).Msgf("Failed to parse message desc for %s in %s", e.Payload, v)
+				continue
+			}
+		}
+	}
+	return nil
+}
+
+func findEmbeddedField(fields []*EmbeddedField, name string) *EmbeddedField {
+	for _, e := range fields {
+		if e.Field == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func findPayloadType(fields []*EmbeddedField, name string) *EmbeddedField {
+	for _, e := range fields {
+		if e.Type == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// payloadTable is a table choosing the message of an embedded payload.
+type payloadTable interface {
+	// Message returns the canonical name of the message of the id.
+	Message(v Protocol, id uint32) string
+	// Translate returns the id of the same message in the other protocol.
+	Translate(from, to Protocol, id uint32) (uint32, bool)
+}
+
+func (m *Mapping) payloadTable(table string) payloadTable {
+	switch table {
+	case PayloadTableAbility:
+		return argumentTables(m.AbilityArgumentMap)
+	case PayloadTableCombat:
+		return argumentTables(m.CombatArgumentMap)
+	case PayloadTableCommand:
+		return commandTable{m}
+	}
+	return nil
+}
+
+type argumentTables map[Protocol]*ArgumentTable
+
+func (t argumentTables) Message(v Protocol, id uint32) string {
+	return t[v].Message(id)
+}
+
+func (t argumentTables) Translate(from, to Protocol, id uint32) (uint32, bool) {
+	return t[from].Translate(t[to], id)
+}
+
+type commandTable struct {
+	m *Mapping
+}
+
+func (t commandTable) Message(v Protocol, id uint32) string {
+	if id > 0xFFFF {
+		return ""
+	}
+	return t.m.CommandNameMap[v][uint16(id)]
+}
+
+func (t commandTable) Translate(from, to Protocol, id uint32) (uint32, bool) {
+	if id > 0xFFFF {
+		return 0, false
+	}
+	if from == to {
+		return id, true
+	}
+	command, ok := t.m.CommandPairMap[from][to][uint16(id)]
+	return uint32(command), ok
+}
@@ -0,0 +1,158 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+func newEmbeddedTestMapping(t *testing.T) *Mapping {
+	shared := map[string]string{
+		"protocol/AbilityInvocationsNotify.proto": `syntax = "proto3";
+import "AbilityInvokeEntry.proto";
+message AbilityInvocationsNotify { repeated AbilityInvokeEntry invokes = 1; }`,
+		"protocol/AbilityInvokeEntry.proto": `syntax = "proto3";
+import "AbilityInvokeArgument.proto";
+message AbilityInvokeEntry {
+  AbilityInvokeArgument argument_type = 3;
+  bytes ability_data = 5;
+  uint32 entity_id = 9;
+}`,
+		"protocol/AbilityMetaLoseHp.proto": `syntax = "proto3";
+message AbilityMetaLoseHp { uint32 lose_hp_config_idx = 1; }`,
+		"protocol/UnionCmdNotify.proto": `syntax = "proto3";
+message UnionCmd { uint32 message_id = 1; bytes body = 2; }
+message UnionCmdNotify { repeated UnionCmd cmd_list = 1; }`,
+		"arguments.json": `{"combat": []}`,
+		"protocol/PingReq.proto": `syntax = "proto3";
+message PingReq { uint32 seq = 1; }`,
+	}
+	v1 := map[string]string{
+		"protocol.csv": "AbilityInvocationsNotify,1198\nUnionCmdNotify,100\nPingReq,10\nOldReq,11\n",
+		"protocol/AbilityInvokeArgument.proto": `syntax = "proto3";
+enum AbilityInvokeArgument {
+  ABILITY_INVOKE_ARGUMENT_NONE = 0;
+  ABILITY_INVOKE_ARGUMENT_META_LOSE_HP = 21;
+  ABILITY_INVOKE_ARGUMENT_MIXIN_NEW_THING = 130;
+  ABILITY_INVOKE_ARGUMENT_OLD_ONLY = 140;
+}`,
+		"protocol/AbilityMixinNewThing.proto": `syntax = "proto3";
+message AbilityMixinNewThing { uint32 value = 1; }`,
+		"protocol/OldReq.proto": `syntax = "proto3";
+message OldReq { uint32 seq = 1; }`,
+	}
+	v2 := map[string]string{
+		"protocol.csv": "AbilityInvocationsNotify,1199\nUnionCmdNotify,102\nPingReq,12\n",
+		"protocol/AbilityInvokeArgument.proto": `syntax = "proto3";
+enum AbilityInvokeArgument {
+  ABILITY_INVOKE_ARGUMENT_NONE = 0;
+  ABILITY_INVOKE_ARGUMENT_META_LOSE_HP = 23;
+  ABILITY_INVOKE_ARGUMENT_MIXIN_NEW_THING = 131;
+}`,
+		"protocol/AbilityMixinNewThing.proto": `syntax = "proto3";
+message AbilityMixinNewThing { string value = 1; }`,
+	}
+	for name, content := range shared {
+		v1[name], v2[name] = content, content
+	}
+	return newTestMapping(t, "v1", map[Protocol]map[string]string{"v1": v1, "v2": v2})
+}
+
+func TestConvertEmbedded(t *testing.T) {
+	m := newEmbeddedTestMapping(t)
+	loseHp := marshalTestMessage(t, m, "v1", "AbilityMetaLoseHp", `{"loseHpConfigIdx":5}`)
+	newThing := marshalTestMessage(t, m, "v1", "AbilityMixinNewThing", `{"value":7}`)
+	ping := marshalTestMessage(t, m, "v1", "PingReq", `{"seq":3}`)
+	old := marshalTestMessage(t, m, "v1", "OldReq", `{"seq":4}`)
+
+	invokes := []struct {
+		argument int32
+		data     []byte
+		entity   uint32
+	}{
+		{argument: 21, data: loseHp, entity: 1},
+		{argument: 99, data: loseHp, entity: 2}, // unknown argument
+		{argument: 130, data: newThing, entity: 3},
+		{argument: 130, data: []byte{0xff}, entity: 4}, // invalid payload
+		{argument: 130, entity: 5},                     // no payload
+		{argument: 140, entity: 6},                     // no counterpart
+	}
+	in := dynamic.NewMessage(m.MessageDescMap["v1"]["AbilityInvocationsNotify"])
+	for _, invoke := range invokes {
+		entry := dynamic.NewMessage(in.GetMessageDescriptor().FindFieldByName("invokes").GetMessageType())
+		entry.SetFieldByName("argument_type", invoke.argument)
+		entry.SetFieldByName("ability_data", invoke.data)
+		entry.SetFieldByName("entity_id", invoke.entity)
+		in.AddRepeatedFieldByName("invokes", entry)
+	}
+	c := m.NewConverter("v1", "v2")
+	out := c.Convert(in, m.MessageDescMap["v2"]["AbilityInvocationsNotify"])
+	entries := out.GetFieldByName("invokes").([]any)
+	want := []struct {
+		argument int32
+		entity   uint32
+		payload  string
+	}{
+		{23, 1, `{"loseHpConfigIdx":5}`},
+		{131, 3, `{"value":"7"}`},
+		{131, 5, ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d invokes, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		entry := entries[i].(*dynamic.Message)
+		if got := entry.GetFieldByName("argument_type").(int32); got != w.argument {
+			t.Errorf("invoke %d: argument_type = %d, want %d", i, got, w.argument)
+		}
+		if got := entry.GetFieldByName("entity_id").(uint32); got != w.entity {
+			t.Errorf("invoke %d: entity_id = %d, want %d", i, got, w.entity)
+		}
+		if got := payloadJSON(t, m, entry.GetFieldByName("ability_data").([]byte), w.argument); got != w.payload {
+			t.Errorf("invoke %d: ability_data = %s, want %s", i, got, w.payload)
+		}
+	}
+
+	in = newTestMessage(t, m, "v1", "UnionCmdNotify", "{}")
+	for _, cmd := range []struct {
+		id   uint32
+		body []byte
+	}{{10, ping}, {11, old}} {
+		entry := dynamic.NewMessage(in.GetMessageDescriptor().FindFieldByName("cmd_list").GetMessageType())
+		entry.SetFieldByName("message_id", cmd.id)
+		entry.SetFieldByName("body", cmd.body)
+		in.AddRepeatedFieldByName("cmd_list", entry)
+	}
+	out = m.NewConverter("v1", "v2").Convert(in, m.MessageDescMap["v2"]["UnionCmdNotify"])
+	cmds := out.GetFieldByName("cmd_list").([]any)
+	if len(cmds) != 1 {
+		t.Fatalf("got %d union commands, want the paired one only", len(cmds))
+	}
+	cmd := cmds[0].(*dynamic.Message)
+	if got := cmd.GetFieldByName("message_id").(uint32); got != 12 {
+		t.Errorf("message_id = %d, want 12", got)
+	}
+	body := dynamic.NewMessage(m.MessageDescMap["v2"]["PingReq"])
+	if err := body.Unmarshal(cmd.GetFieldByName("body").([]byte)); err != nil {
+		t.Fatal(err)
+	}
+	if got := body.GetFieldByName("seq").(uint32); got != 3 {
+		t.Errorf("body seq = %d, want 3", got)
+	}
+}
+
+func payloadJSON(t *testing.T, m *Mapping, data []byte, argument int32) string {
+	if len(data) == 0 {
+		return ""
+	}
+	name := m.AbilityArgumentMap["v2"].Message(uint32(argument))
+	payload := dynamic.NewMessage(m.MessageDescMap["v2"][name])
+	if err := payload.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	js, err := payload.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(js)
+}
@@ -0,0 +1,362 @@
+package mapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// UnmappedID is what becomes of an id found neither in the table nor in its
+// identical ranges.
+type UnmappedID string
+
+const (
+	UnmappedKeep     UnmappedID = "keep"     // the id as it is
+	UnmappedDrop     UnmappedID = "drop"     // the field or the element is removed
+	UnmappedFallback UnmappedID = "fallback" // the fallback id
+)
+
+// IDTable rewrites the content ids, of avatars, weapons, materials, scenes
+// or gadgets, of the fields converted from one protocol to another.
+type IDTable struct {
+	Name      string
+	IDs       map[uint64]uint64
+	Identical [][2]uint64
+	Unmapped  UnmappedID
+	Fallback  uint64
+}
+
+// Map returns the id in the target protocol, false if it is dropped.
+func (t *IDTable) Map(id uint64) (uint64, bool) {
+	if to, ok := t.IDs[id]; ok {
+		return to, true
+	}
+	for _, r := range t.Identical {
+		if id >= r[0] && id <= r[1] {
+			return id, true
+		}
+	}
+	switch t.Unmapped {
+	case UnmappedDrop:
+		return 0, false
+	case UnmappedFallback:
+		return t.Fallback, true
+	}
+	return id, true
+}
+
+// IDFields are the id tables of the fields converted from one protocol to
+// another, by message and field, or by field in every message.
+type IDFields struct {
+	Messages map[string]map[string]*IDTable
+	Fields   map[string]*IDTable
+}
+
+// Find returns the table of the field of the message, nil if there is none.
+func (f *IDFields) Find(message, field string) *IDTable {
+	if f == nil {
+		return nil
+	}
+	if t := f.Messages[message][field]; t != nil {
+		return t
+	}
+	return f.Fields[field]
+}
+
+// has tells if a field of the message has a table.
+func (f *IDFields) has(md *desc.MessageDescriptor) bool {
+	if f == nil {
+		return false
+	}
+	if len(f.Messages[md.GetName()]) > 0 {
+		return true
+	}
+	for _, fd := range md.GetFields() {
+		if f.Fields[fd.GetName()] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// remapIDs rewrites the converted value of the field through the table, the
+// unmapped ids dropped from a repeated field are removed from it.
+func (c *Converter) remapIDs(t *IDTable, toField *desc.FieldDescriptor, value any) (any, bool) {
+	if toField.IsMap() || !isIntegerField(toField) {
+		return value, true
+	}
+	if values, ok := value.([]any); ok {
+		out := make([]any, 0, len(values))
+		for _, v := range values {
+			if v, ok = c.remapID(t, toField, v); ok {
+				out = append(out, v)
+			}
+		}
+		return out, true
+	}
+	return c.remapID(t, toField, value)
+}
+
+func (c *Converter) remapID(t *IDTable, toField *desc.FieldDescriptor, value any) (any, bool) {
+	id, ok := coerceUint(value, 64)
+	if !ok {
+		return value, true
+	}
+	to, ok := t.Map(id)
+	if !ok {
+		logger.Debug().Msgf("Dropping unmapped %s id %d of %s", t.Name, id, strings.Join(c.path, "."))
+		c.drop()
+		return nil, false
+	}
+	if to == id {
+		return value, true
+	}
+	if value, ok = coerceScalar(toField, to); !ok {
+		return c.fail(toField, toField)
+	}
+	return value, true
+}
+
+func isIntegerField(fd *desc.FieldDescriptor) bool {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return true
+	}
+	return false
+}
+
+// idsConfig is a single table of data/mapping/{{ VERSION }}/ids/{{ OTHER }}.json,
+// the ids are those of {{ VERSION }} on the left and of {{ OTHER }} on the
+// right. A field is a field name, in every message, or a message followed
+// by the path of the field, e.g. SceneAvatarInfo.weapon.item_id.
+type idsConfig struct {
+	Name            string            `json:"name,omitempty"`
+	Fields          []string          `json:"fields"`
+	IDs             map[string]uint64 `json:"ids,omitempty"`
+	Identical       []string          `json:"identical,omitempty"`
+	Unmapped        UnmappedID        `json:"unmapped,omitempty"`
+	Fallback        *uint64           `json:"fallback,omitempty"`
+	ReverseUnmapped UnmappedID        `json:"reverseUnmapped,omitempty"`
+	ReverseFallback *uint64           `json:"reverseFallback,omitempty"`
+}
+
+func (m *Mapping) loadIDs() error {
+	m.IDFieldsMap = make(map[Protocol]map[Protocol]*IDFields)
+	for v, src := range m.sources {
+		for u := range m.sources {
+			if v == u || m.MessageDescMap[u] == nil {
+				continue
+			}
+			if err := m.loadPairIDs(v, u, src, path.Join("ids", string(u)+".json")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Mapping) loadPairIDs(v, u Protocol, src *protocolSource, name string) error {
+	file := src.path(name)
+	data, err := fs.ReadFile(src, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read ids %s: %w", file, err)
+	}
+	var entries []*idsConfig
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse ids %s: %w", file, err)
+	}
+	logger.Info().Msgf("Loading ids between %s and %s", v, u)
+	for i, entry := range entries {
+		if entry.Name == "" {
+			entry.Name = strconv.Itoa(i)
+		}
+		forward, reverse, err := newIDTables(entry)
+		if err != nil {
+			return fmt.Errorf("invalid ids %s in %s: %w", entry.Name, file, err)
+		}
+		if len(entry.Fields) == 0 {
+			return fmt.Errorf("invalid ids %s in %s: no fields", entry.Name, file)
+		}
+		for _, p := range entry.Fields {
+			message, field, err := m.resolveIDField(v, p)
+			if err != nil {
+				return fmt.Errorf("invalid ids %s in %s: %w", entry.Name, file, err)
+			}
+			m.idFields(v, u).add(message, field, forward)
+			m.idFields(u, v).add(message, field, reverse)
+		}
+	}
+	return nil
+}
+
+func newIDTables(entry *idsConfig) (*IDTable, *IDTable, error) {
+	forward := &IDTable{Name: entry.Name, IDs: make(map[uint64]uint64)}
+	reverse := &IDTable{Name: entry.Name, IDs: make(map[uint64]uint64)}
+	for from, to := range entry.IDs {
+		id, err := strconv.ParseUint(from, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid id %q", from)
+		}
+		forward.IDs[id] = to
+		if other, ok := reverse.IDs[to]; ok {
+			logger.Warn().Msgf("Ids %d and %d of %s are both mapped to %d, only %d is mapped back", other, id, entry.Name, to, min64(other, id))
+			id = min64(other, id)
+		}
+		reverse.IDs[to] = id
+	}
+	for _, r := range entry.Identical {
+		lo, hi, found := strings.Cut(r, "-")
+		if !found {
+			hi = lo
+		}
+		a, aErr := strconv.ParseUint(strings.TrimSpace(lo), 10, 64)
+		b, bErr := strconv.ParseUint(strings.TrimSpace(hi), 10, 64)
+		if aErr != nil || bErr != nil || a > b {
+			return nil, nil, fmt.Errorf("invalid identical range %q", r)
+		}
+		forward.Identical = append(forward.Identical, [2]uint64{a, b})
+	}
+	reverse.Identical = forward.Identical
+	var err error
+	if forward.Unmapped, forward.Fallback, err = unmappedPolicy(entry.Unmapped, entry.Fallback); err != nil {
+		return nil, nil, err
+	}
+	if reverse.Unmapped, reverse.Fallback, err = unmappedPolicy(entry.ReverseUnmapped, entry.ReverseFallback); err != nil {
+		return nil, nil, err
+	}
+	return forward, reverse, nil
+}
+
+// unmappedPolicy falls back to the fallback id if there is one, and keeps
+// the unmapped ids otherwise.
+func unmappedPolicy(unmapped UnmappedID, fallback *uint64) (UnmappedID, uint64, error) {
+	switch unmapped {
+	case "":
+		if fallback != nil {
+			return UnmappedFallback, *fallback, nil
+		}
+		return UnmappedKeep, 0, nil
+	case UnmappedKeep, UnmappedDrop:
+		return unmapped, 0, nil
+	case UnmappedFallback:
+		if fallback == nil {
+			return "", 0, errors.New("fallback without a fallback id")
+		}
+		return unmapped, *fallback, nil
+	}
+	return "", 0, fmt.Errorf("unknown unmapped policy %q", unmapped)
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// resolveIDField returns the message holding the field, empty for a field
+// name alone, following the path through the messages of the protocol.
+func (m *Mapping) resolveIDField(v Protocol, field string) (string, string, error) {
+	parts := splitFieldPath(field)
+	if len(parts) == 1 {
+		return "", field, nil
+	}
+	md := m.findMessage(v, parts[0])
+	if md == nil {
+		return "", "", fmt.Errorf("unknown message %s in %s", parts[0], v)
+	}
+	var fd *desc.FieldDescriptor
+	for _, name := range parts[1:] {
+		if md == nil {
+			return "", "", fmt.Errorf("unknown field %s in %s", field, v)
+		}
+		if fd = findField(md, name); fd == nil {
+			return "", "", fmt.Errorf("unknown field %s in %s", field, v)
+		}
+		// The path goes through the elements of repeated fields and the
+		// values of maps.
+		if fd.IsMap() {
+			md = fd.GetMapValueType().GetMessageType()
+		} else {
+			md = fd.GetMessageType()
+		}
+	}
+	return fd.GetOwner().GetName(), fd.GetName(), nil
+}
+
+// findMessage finds the message by name among the messages of the protocol
+// and those they hold.
+func (m *Mapping) findMessage(v Protocol, name string) *desc.MessageDescriptor {
+	if md := m.MessageDescMap[v][name]; md != nil {
+		return md
+	}
+	seen := make(map[*desc.MessageDescriptor]bool)
+	var find func(md *desc.MessageDescriptor) *desc.MessageDescriptor
+	find = func(md *desc.MessageDescriptor) *desc.MessageDescriptor {
+		if md == nil || seen[md] {
+			return nil
+		}
+		seen[md] = true
+		if md.GetName() == name {
+			return md
+		}
+		for _, fd := range md.GetFields() {
+			if found := find(fd.GetMessageType()); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	for _, md := range m.MessageDescMap[v] {
+		if found := find(md); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (m *Mapping) idFields(from, to Protocol) *IDFields {
+	if m.IDFieldsMap[from] == nil {
+		m.IDFieldsMap[from] = make(map[Protocol]*IDFields)
+	}
+	f := m.IDFieldsMap[from][to]
+	if f == nil {
+		f = &IDFields{
+			Messages: make(map[string]map[string]*IDTable),
+			Fields:   make(map[string]*IDTable),
+		}
+		m.IDFieldsMap[from][to] = f
+	}
+	return f
+}
+
+func (f *IDFields) add(message, field string, t *IDTable) {
+	if message == "" {
+		f.Fields[field] = t
+		return
+	}
+	if f.Messages[message] == nil {
+		f.Messages[message] = make(map[string]*IDTable)
+	}
+	f.Messages[message][field] = t
+}
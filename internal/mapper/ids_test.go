@@ -0,0 +1,86 @@
+package mapper
+
+import (
+	"testing"
+)
+
+func TestIDTableMap(t *testing.T) {
+	table := func(unmapped UnmappedID) *IDTable {
+		return &IDTable{
+			Name:      "avatars",
+			IDs:       map[uint64]uint64{10000001: 10000101, 10000002: 10000002},
+			Identical: [][2]uint64{{20000000, 20000099}, {30000000, 30000000}},
+			Unmapped:  unmapped,
+			Fallback:  10000007,
+		}
+	}
+	tests := []struct {
+		name     string
+		unmapped UnmappedID
+		id       uint64
+		want     uint64
+		ok       bool
+	}{
+		{"mapped", UnmappedDrop, 10000001, 10000101, true},
+		{"mapped to itself", UnmappedDrop, 10000002, 10000002, true},
+		{"range start", UnmappedDrop, 20000000, 20000000, true},
+		{"range end", UnmappedDrop, 20000099, 20000099, true},
+		{"single id range", UnmappedDrop, 30000000, 30000000, true},
+		{"past the range", UnmappedDrop, 20000100, 0, false},
+		{"keep", UnmappedKeep, 10000003, 10000003, true},
+		{"keep by default", "", 10000003, 10000003, true},
+		{"drop", UnmappedDrop, 10000003, 0, false},
+		{"fallback", UnmappedFallback, 10000003, 10000007, true},
+		{"mapped before the fallback", UnmappedFallback, 10000001, 10000101, true},
+		{"range before the fallback", UnmappedFallback, 20000050, 20000050, true},
+	}
+	for _, tt := range tests {
+		got, ok := table(tt.unmapped).Map(tt.id)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: Map(%d) = %d, %t, want %d, %t", tt.name, tt.id, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewIDTables(t *testing.T) {
+	fallback := uint64(1)
+	forward, reverse, err := newIDTables(&idsConfig{
+		Name:            "weapons",
+		IDs:             map[string]uint64{"11101": 11201, "11102": 11202, "11103": 11202},
+		Identical:       []string{"12000-12099", "13000"},
+		Unmapped:        UnmappedDrop,
+		ReverseFallback: &fallback,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forward.Unmapped != UnmappedDrop || reverse.Unmapped != UnmappedFallback || reverse.Fallback != 1 {
+		t.Errorf("policies %s and %s %d, want drop and fallback 1", forward.Unmapped, reverse.Unmapped, reverse.Fallback)
+	}
+	if got, ok := forward.Map(11103); got != 11202 || !ok {
+		t.Errorf("Map(11103) = %d, %t, want 11202, true", got, ok)
+	}
+	// Of the ids mapped to the same id, the lowest is mapped back.
+	if got, ok := reverse.Map(11202); got != 11102 || !ok {
+		t.Errorf("reverse Map(11202) = %d, %t, want 11102, true", got, ok)
+	}
+	if got, ok := reverse.Map(12050); got != 12050 || !ok {
+		t.Errorf("reverse Map(12050) = %d, %t, want 12050, true", got, ok)
+	}
+	if got, ok := reverse.Map(13001); got != 1 || !ok {
+		t.Errorf("reverse Map(13001) = %d, %t, want 1, true", got, ok)
+	}
+
+	invalid := []*idsConfig{
+		{IDs: map[string]uint64{"x": 1}},
+		{Identical: []string{"20-10"}},
+		{Identical: []string{"a-b"}},
+		{Unmapped: UnmappedFallback},
+		{ReverseUnmapped: "skip"},
+	}
+	for _, entry := range invalid {
+		if _, _, err := newIDTables(entry); err == nil {
+			t.Errorf("newIDTables(%+v) succeeded, want an error", entry)
+		}
+	}
+}
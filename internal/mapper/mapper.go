@@ -1,6 +1,9 @@
 package mapper
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/jhump/protoreflect/desc"
 
 	"github.com/Jx2f/ViaGenshin/internal/config"
@@ -9,14 +12,33 @@ import (
 type Protocol = config.Protocol
 
 type Mapping struct {
-	config *config.ConfigProtocols
+	config  *config.ConfigProtocols
+	sources map[Protocol]*protocolSource
 
 	BaseProtocol Protocol
 	BaseCommands map[string]uint16
 
+	CommandIDMap   map[Protocol]map[string]uint16
 	CommandNameMap map[Protocol]map[uint16]string
 	CommandPairMap map[Protocol]map[Protocol]map[uint16]uint16
 	MessageDescMap map[Protocol]map[string]*desc.MessageDescriptor
+
+	MessageAliasMap map[Protocol]map[string]string
+	MessageLocalMap map[Protocol]map[string]string
+
+	AbilityArgumentMap map[Protocol]*ArgumentTable
+	CombatArgumentMap  map[Protocol]*ArgumentTable
+	EmbeddedFieldMap   map[Protocol]map[string][]*EmbeddedField
+
+	MessageRulesMap map[Protocol]map[Protocol]map[string]*MessageRules
+	EnumRulesMap    map[Protocol]map[Protocol]map[string]EnumRules
+	IDFieldsMap     map[Protocol]map[Protocol]*IDFields
+
+	SchemaEqualMap map[Protocol]map[Protocol]map[string]bool
+	messageEqual   map[[2]*desc.MessageDescriptor]bool
+
+	fieldPairCache sync.Map
+	defaultCache   sync.Map
 }
 
 func NewMappingFromConfig(c *config.ConfigProtocols) (*Mapping, error) {
@@ -24,19 +46,44 @@ func NewMappingFromConfig(c *config.ConfigProtocols) (*Mapping, error) {
 	m.config = c
 	m.BaseProtocol = m.config.BaseProtocol
 	m.BaseCommands = make(map[string]uint16)
+	m.CommandIDMap = make(map[Protocol]map[string]uint16)
 	m.CommandNameMap = make(map[Protocol]map[uint16]string)
 	m.CommandPairMap = make(map[Protocol]map[Protocol]map[uint16]uint16)
 	m.MessageDescMap = make(map[Protocol]map[string]*desc.MessageDescriptor)
+	m.MessageAliasMap = make(map[Protocol]map[string]string)
+	m.MessageLocalMap = make(map[Protocol]map[string]string)
+	m.AbilityArgumentMap = make(map[Protocol]*ArgumentTable)
+	m.CombatArgumentMap = make(map[Protocol]*ArgumentTable)
+	m.EmbeddedFieldMap = make(map[Protocol]map[string][]*EmbeddedField)
+	m.MessageRulesMap = make(map[Protocol]map[Protocol]map[string]*MessageRules)
+	m.EnumRulesMap = make(map[Protocol]map[Protocol]map[string]EnumRules)
+	m.SchemaEqualMap = make(map[Protocol]map[Protocol]map[string]bool)
+	m.sources = make(map[Protocol]*protocolSource)
+	for v, location := range m.config.Mapping {
+		src, err := openProtocol(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open protocol %s: %w", v, err)
+		}
+		m.sources[v] = src
+	}
 	if err := m.loadBaseProtocol(); err != nil {
 		return nil, err
 	}
-	for v, dir := range m.config.Mapping {
+	for v, src := range m.sources {
 		if v == m.BaseProtocol {
 			continue
 		}
-		if err := m.loadProtocol(v, dir); err != nil {
+		if err := m.loadProtocol(v, src); err != nil {
 			return nil, err
 		}
 	}
+	m.loadCommandPairs()
+	if err := m.loadRules(); err != nil {
+		return nil, err
+	}
+	if err := m.loadIDs(); err != nil {
+		return nil, err
+	}
+	m.loadSchemaEquality()
 	return m, nil
 }
@@ -0,0 +1,117 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+
+	"github.com/Jx2f/ViaGenshin/internal/config"
+)
+
+// newTestMapping writes the files of each protocol, by their path in the
+// protocol directory, and loads the mapping of them.
+func newTestMapping(tb testing.TB, base Protocol, protocols map[Protocol]map[string]string) *Mapping {
+	tb.Helper()
+	m, err := loadTestMapping(tb, base, protocols)
+	if err != nil {
+		tb.Fatalf("failed to load mapping: %v", err)
+	}
+	return m
+}
+
+func loadTestMapping(tb testing.TB, base Protocol, protocols map[Protocol]map[string]string) (*Mapping, error) {
+	tb.Helper()
+	dir := tb.TempDir()
+	c := &config.ConfigProtocols{BaseProtocol: base, Mapping: make(map[Protocol]string)}
+	for v, files := range protocols {
+		root := filepath.Join(dir, string(v))
+		for name, content := range files {
+			file := filepath.Join(root, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				tb.Fatal(err)
+			}
+			if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		c.Mapping[v] = root
+	}
+	return NewMappingFromConfig(c)
+}
+
+// newTestMessage returns the message of the protocol read from JSON.
+func newTestMessage(tb testing.TB, m *Mapping, v Protocol, name, js string) *dynamic.Message {
+	tb.Helper()
+	md := m.MessageDescMap[v][name]
+	if md == nil {
+		tb.Fatalf("unknown message %s in %s", name, v)
+	}
+	msg := dynamic.NewMessage(md)
+	if err := msg.UnmarshalJSON([]byte(js)); err != nil {
+		tb.Fatalf("failed to unmarshal %s: %v", name, err)
+	}
+	return msg
+}
+
+// marshalTestMessage returns the serialized message of the protocol read
+// from JSON.
+func marshalTestMessage(tb testing.TB, m *Mapping, v Protocol, name, js string) []byte {
+	tb.Helper()
+	data, err := newTestMessage(tb, m, v, name, js).Marshal()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// checkConverted converts the message from one protocol to the other and
+// compares it with the message read from the JSON want.
+func checkConverted(tb testing.TB, m *Mapping, from, to Protocol, name, in, want string) {
+	tb.Helper()
+	out := m.NewConverter(from, to).Convert(newTestMessage(tb, m, from, name, in), m.MessageDescMap[to][name])
+	if w := newTestMessage(tb, m, to, name, want); !dynamic.Equal(out, w) {
+		got, _ := out.MarshalJSON()
+		tb.Errorf("%s %s to %s:\n got %s\nwant %s", name, from, to, got, want)
+	}
+}
+
+func TestCommandAliasConflict(t *testing.T) {
+	for _, csv := range []string{
+		"EvtBeingHitNotify,20\nEvtBeingHit,21\n",
+		"EvtBeingHit,21\nEvtBeingHitNotify,20\n",
+	} {
+		m := newTestMapping(t, "v1", map[Protocol]map[string]string{
+			"v1": {
+				"protocol.csv":   "EvtBeingHitInfo,10\n",
+				"arguments.json": `{"ability": [], "combat": []}`,
+				"protocol/EvtBeingHitInfo.proto": `syntax = "proto3";
+message EvtBeingHitInfo { uint32 attacker_id = 1; }`,
+			},
+			"v2": {
+				"protocol.csv":   csv,
+				"arguments.json": `{"ability": [], "combat": []}`,
+				"aliases.json":   `{"EvtBeingHitNotify": "EvtBeingHitInfo", "EvtBeingHit": "EvtBeingHitInfo"}`,
+				"protocol/EvtBeingHitNotify.proto": `syntax = "proto3";
+message EvtBeingHitNotify { uint32 attacker_id = 1; }`,
+				"protocol/EvtBeingHit.proto": `syntax = "proto3";
+message EvtBeingHit { uint32 attacker_id = 1; }`,
+			},
+		})
+		// The alias first in alphabetical order is kept, whatever the order
+		// of the commands.
+		if id := m.CommandIDMap["v2"]["EvtBeingHitInfo"]; id != 21 {
+			t.Errorf("%q: command id %d, want 21", csv, id)
+		}
+		if name, ok := m.CommandNameMap["v2"][20]; ok {
+			t.Errorf("%q: command 20 is %s, want none", csv, name)
+		}
+		if md := m.MessageDescMap["v2"]["EvtBeingHitInfo"]; md == nil || md.GetName() != "EvtBeingHit" {
+			t.Errorf("%q: message %v, want EvtBeingHit", csv, md)
+		}
+		if id := m.CommandPairMap["v1"]["v2"][10]; id != 21 {
+			t.Errorf("%q: command 10 paired with %d, want 21", csv, id)
+		}
+	}
+}
@@ -2,94 +2,107 @@ package mapper
 
 import (
 	"fmt"
-	"os"
-	"path"
-	"strconv"
-	"strings"
 
 	"github.com/jhump/protoreflect/desc"
-	"github.com/jhump/protoreflect/desc/protoparse"
 
 	"github.com/Jx2f/ViaGenshin/pkg/logger"
 )
 
 func (m *Mapping) loadBaseProtocol() error {
 	logger.Info().Msgf("Loading base protocol %s", m.BaseProtocol)
-	return m.loadProtocol(m.BaseProtocol, m.config.Mapping[m.BaseProtocol])
+	src := m.sources[m.BaseProtocol]
+	if src == nil {
+		return fmt.Errorf("base protocol %s is not in the mapping", m.BaseProtocol)
+	}
+	return m.loadProtocol(m.BaseProtocol, src)
 }
 
-func (m *Mapping) loadProtocol(v Protocol, dir string) error {
+// PacketHead is the message of the packet heads, it is loaded along with the
+// commands.
+const PacketHead = "PacketHead"
+
+func (m *Mapping) loadProtocol(v Protocol, src *protocolSource) error {
 	logger.Info().Msgf("Loading protocol %s", v)
-	data, err := os.ReadFile(path.Join(dir, "protocol.csv"))
+	if err := m.loadAliases(v, src); err != nil {
+		return err
+	}
+	files, err := loadProtoFiles(v, src)
 	if err != nil {
-		return fmt.Errorf("failed to read protocol.csv: %w", err)
+		return err
 	}
-	m.CommandNameMap[v] = make(map[uint16]string)
-	m.CommandPairMap[v] = make(map[Protocol]map[uint16]uint16)
-	if v != m.BaseProtocol {
-		m.CommandPairMap[v][m.BaseProtocol] = make(map[uint16]uint16)
-		m.CommandPairMap[m.BaseProtocol][v] = make(map[uint16]uint16)
+	commands, err := m.readCommands(v, src, files)
+	if err != nil {
+		return err
 	}
+	m.CommandIDMap[v] = make(map[string]uint16)
+	m.CommandNameMap[v] = make(map[uint16]string)
 	m.MessageDescMap[v] = make(map[string]*desc.MessageDescriptor)
-	parser := &protoparse.Parser{ImportPaths: []string{path.Join(dir, "protocol")}}
-	for _, line := range strings.Split(string(data), "\n") {
-		parts := strings.Split(strings.TrimSpace(line), ",")
-		if len(parts) != 2 {
-			continue
-		}
-		name := parts[0]
-		if name == "" || name == "DebugNotify" {
+	for _, c := range commands {
+		if c.Name == "DebugNotify" {
 			continue
 		}
-		command, err := strconv.ParseUint(parts[1], 10, 16)
-		if err != nil {
-			logger.Warn().Err(err).Msgf("Failed to parse command %s for %s in %s", parts[1], name, v)
-			continue
-		}
-		if err := m.parseCommandDesc(parser, v, name, uint16(command)); err != nil {
-			logger.Warn().Err(err).Msgf("Failed to parse command desc for %s in %s", name, v)
+		if err := m.parseCommandDesc(files, v, c); err != nil {
+			logger.Warn().Err(err).Msgf("Failed to parse command desc for %s in %s", c.Name, v)
 			continue
 		}
 	}
-	for _, name := range AbilityInvokeArguments {
-		if name == "" {
-			continue
-		}
-		if err := m.parseMessageDesc(parser, v, name); err != nil {
-			logger.Warn().Err(err).Msgf("Failed to parse message desc for %s in %s", name, v)
-			continue
-		}
+	head := m.LocalName(v, PacketHead)
+	if err := m.parseMessageDesc(files, v, head, head+".proto"); err != nil {
+		logger.Warn().Err(err).Msgf("Failed to parse message desc for %s in %s, the heads of the injected packets are copied", PacketHead, v)
 	}
-	for _, name := range CombatTypeArguments {
-		if name == "" {
-			continue
-		}
-		if err := m.parseMessageDesc(parser, v, name); err != nil {
-			logger.Warn().Err(err).Msgf("Failed to parse message desc for %s in %s", name, v)
-			continue
-		}
+	if err := m.loadArguments(files, v, src); err != nil {
+		return err
 	}
-	return nil
+	return m.loadEmbedded(files, v, src)
 }
 
-func (m *Mapping) parseCommandDesc(parser *protoparse.Parser, v Protocol, name string, command uint16) error {
-	m.CommandNameMap[v][command] = name
+func (m *Mapping) parseCommandDesc(files *protoFiles, v Protocol, c *commandEntry) error {
+	name := m.CanonicalName(v, c.Name)
+	if id, ok := m.CommandIDMap[v][name]; ok && id != c.ID {
+		// Of the commands aliased to the same name, the one the name
+		// resolves to is kept.
+		if c.Name != m.LocalName(v, name) {
+			return fmt.Errorf("command %s %d is an alias of %s, already command %d", c.Name, c.ID, name, id)
+		}
+		delete(m.CommandNameMap[v], id)
+	}
+	m.CommandIDMap[v][name] = c.ID
+	m.CommandNameMap[v][c.ID] = name
 	if v == m.BaseProtocol {
-		m.BaseCommands[name] = command
-	} else if baseCommand, ok := m.BaseCommands[name]; ok && baseCommand != 0 {
-		m.CommandPairMap[v][m.BaseProtocol][command] = baseCommand
-		m.CommandPairMap[m.BaseProtocol][v][baseCommand] = command
-	} else {
-		logger.Debug().Msgf("Failed to find base command for %s in %s", name, v)
+		m.BaseCommands[name] = c.ID
+	}
+	return m.parseMessageDesc(files, v, c.Name, c.File)
+}
+
+// loadCommandPairs pairs the commands of every two loaded protocols by name,
+// so that any version can be converted to any other without going through
+// the base protocol.
+func (m *Mapping) loadCommandPairs() {
+	for from, names := range m.CommandNameMap {
+		m.CommandPairMap[from] = make(map[Protocol]map[uint16]uint16)
+		for to, commands := range m.CommandIDMap {
+			if from == to {
+				continue
+			}
+			pairs := make(map[uint16]uint16)
+			for fromCommand, name := range names {
+				toCommand, ok := commands[name]
+				if !ok || toCommand == 0 {
+					logger.Debug().Msgf("Failed to find command %s of %s in %s", name, from, to)
+					continue
+				}
+				pairs[fromCommand] = toCommand
+			}
+			m.CommandPairMap[from][to] = pairs
+		}
 	}
-	return m.parseMessageDesc(parser, v, name)
 }
 
-func (m *Mapping) parseMessageDesc(parser *protoparse.Parser, v Protocol, name string) error {
-	fd, err := parser.ParseFiles(name + ".proto")
+func (m *Mapping) parseMessageDesc(files *protoFiles, v Protocol, name, file string) error {
+	fd, err := files.find(file)
 	if err != nil {
 		return err
 	}
-	m.MessageDescMap[v][name] = fd[0].FindMessage(name)
+	m.MessageDescMap[v][m.CanonicalName(v, name)] = fd.FindMessage(name)
 	return nil
 }
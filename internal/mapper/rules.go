@@ -0,0 +1,161 @@
+package mapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/Jx2f/ViaGenshin/pkg/logger"
+)
+
+// MessageRules describes how a message is reshaped when converted from one
+// protocol to another.
+type MessageRules struct {
+	// Moves relocate a field of the source message to another path in the
+	// target message, a rename is a move within the same message.
+	Moves []*FieldMove
+	// Defaults are set on the target message if the field is still empty
+	// after the conversion.
+	Defaults []*FieldDefault
+	// Wraps put the value of a source field into the named field of the
+	// target message type, keyed by the source field name.
+	Wraps map[string]string
+	// Unwraps take the named field out of the source message type as the
+	// value of the target field, keyed by the target field name.
+	Unwraps map[string]string
+}
+
+type FieldMove struct {
+	From []string
+	To   []string
+}
+
+type FieldDefault struct {
+	Path  []string
+	Value json.RawMessage
+}
+
+// EnumRules maps the enum constant names of the source protocol to those of
+// the target protocol, for the values renamed between the versions.
+type EnumRules map[string]string
+
+// rulesConfig is a single entry of data/mapping/{{ VERSION }}/rules/{{ OTHER }}.json,
+// field paths and enum values are written in the {{ VERSION }} side on the
+// left and the {{ OTHER }} side on the right.
+type rulesConfig struct {
+	Message         string                     `json:"message,omitempty"`
+	Enum            string                     `json:"enum,omitempty"`
+	Values          map[string]string          `json:"values,omitempty"`
+	Rename          map[string]string          `json:"rename,omitempty"`
+	Move            map[string]string          `json:"move,omitempty"`
+	Defaults        map[string]json.RawMessage `json:"defaults,omitempty"`
+	ReverseDefaults map[string]json.RawMessage `json:"reverseDefaults,omitempty"`
+	Wrap            map[string]string          `json:"wrap,omitempty"`
+}
+
+func (m *Mapping) loadRules() error {
+	for v, src := range m.sources {
+		for u := range m.sources {
+			if v == u {
+				continue
+			}
+			if err := m.loadPairRules(v, u, src, path.Join("rules", string(u)+".json")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Mapping) loadPairRules(v, u Protocol, src *protocolSource, name string) error {
+	file := src.path(name)
+	data, err := fs.ReadFile(src, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read rules %s: %w", file, err)
+	}
+	var entries []*rulesConfig
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse rules %s: %w", file, err)
+	}
+	logger.Info().Msgf("Loading rules between %s and %s", v, u)
+	for _, entry := range entries {
+		if entry.Enum != "" {
+			forward := m.enumRules(v, u, entry.Enum)
+			reverse := m.enumRules(u, v, entry.Enum)
+			for from, to := range entry.Values {
+				forward[from] = to
+				reverse[to] = from
+			}
+			continue
+		}
+		if entry.Message == "" {
+			return fmt.Errorf("rule without message or enum name in %s", file)
+		}
+		// The rules are kept by the canonical name, a local name of the
+		// protocol is accepted too.
+		name := m.CanonicalName(v, entry.Message)
+		forward := m.messageRules(v, u, name)
+		reverse := m.messageRules(u, v, name)
+		for from, to := range entry.Rename {
+			forward.Moves = append(forward.Moves, &FieldMove{From: []string{from}, To: []string{to}})
+			reverse.Moves = append(reverse.Moves, &FieldMove{From: []string{to}, To: []string{from}})
+		}
+		for from, to := range entry.Move {
+			forward.Moves = append(forward.Moves, &FieldMove{From: splitFieldPath(from), To: splitFieldPath(to)})
+			reverse.Moves = append(reverse.Moves, &FieldMove{From: splitFieldPath(to), To: splitFieldPath(from)})
+		}
+		for field, value := range entry.Defaults {
+			forward.Defaults = append(forward.Defaults, &FieldDefault{Path: splitFieldPath(field), Value: value})
+		}
+		for field, value := range entry.ReverseDefaults {
+			reverse.Defaults = append(reverse.Defaults, &FieldDefault{Path: splitFieldPath(field), Value: value})
+		}
+		for field, inner := range entry.Wrap {
+			forward.Wraps[field] = inner
+			reverse.Unwraps[field] = inner
+		}
+	}
+	return nil
+}
+
+func (m *Mapping) messageRules(from, to Protocol, name string) *MessageRules {
+	if m.MessageRulesMap[from] == nil {
+		m.MessageRulesMap[from] = make(map[Protocol]map[string]*MessageRules)
+	}
+	if m.MessageRulesMap[from][to] == nil {
+		m.MessageRulesMap[from][to] = make(map[string]*MessageRules)
+	}
+	rules := m.MessageRulesMap[from][to][name]
+	if rules == nil {
+		rules = &MessageRules{
+			Wraps:   make(map[string]string),
+			Unwraps: make(map[string]string),
+		}
+		m.MessageRulesMap[from][to][name] = rules
+	}
+	return rules
+}
+
+func (m *Mapping) enumRules(from, to Protocol, name string) EnumRules {
+	if m.EnumRulesMap[from] == nil {
+		m.EnumRulesMap[from] = make(map[Protocol]map[string]EnumRules)
+	}
+	if m.EnumRulesMap[from][to] == nil {
+		m.EnumRulesMap[from][to] = make(map[string]EnumRules)
+	}
+	rules := m.EnumRulesMap[from][to][name]
+	if rules == nil {
+		rules = make(EnumRules)
+		m.EnumRulesMap[from][to][name] = rules
+	}
+	return rules
+}
+
+func splitFieldPath(p string) []string {
+	return strings.Split(p, ".")
+}
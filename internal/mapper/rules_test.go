@@ -0,0 +1,134 @@
+package mapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func newRulesTestMapping(t *testing.T, rules string) (*Mapping, error) {
+	return loadTestMapping(t, "v1", map[Protocol]map[string]string{
+		"v1": {
+			"protocol.csv":   "EntityNotify,10\nHpNotify,11\n",
+			"rules/v2.json":  rules,
+			"arguments.json": `{"ability": [], "combat": []}`,
+			"protocol/Vector.proto": `syntax = "proto3";
+message Vector { float x = 1; float y = 2; float z = 3; }`,
+			"protocol/EntityNotify.proto": `syntax = "proto3";
+import "Vector.proto";
+message EntityNotify {
+  uint32 entity_id = 1;
+  Vector pos = 2;
+  uint32 old_name = 3;
+  repeated Info infos = 4;
+  map<uint32, Info> info_map = 5;
+  message Info { uint32 a = 1; uint32 b = 2; }
+}`,
+			"protocol/HpNotify.proto": `syntax = "proto3";
+message HpNotify { uint32 hp = 1; }`,
+		},
+		"v2": {
+			"protocol.csv":   "EntityNotify,20\nHpNotify,21\n",
+			"arguments.json": `{"ability": [], "combat": []}`,
+			"protocol/Vector.proto": `syntax = "proto3";
+message Vector { float x = 1; float y = 2; float z = 3; }`,
+			"protocol/EntityNotify.proto": `syntax = "proto3";
+import "Vector.proto";
+message EntityNotify {
+  uint32 entity_id = 1;
+  Motion motion = 2;
+  uint32 new_name = 3;
+  repeated Info infos = 4;
+  map<uint32, Info> info_map = 5;
+  uint32 extra = 6;
+  message Info { uint32 a2 = 1; uint32 b = 2; }
+  message Motion { Vector pos = 1; uint32 state = 2; }
+}`,
+			"protocol/HpNotify.proto": `syntax = "proto3";
+message HpNotify { HpInfo hp = 1; }
+message HpInfo { uint32 value = 1; }`,
+		},
+	})
+}
+
+const testRules = `[
+  {
+    "message": "EntityNotify",
+    "rename": {"old_name": "new_name"},
+    "move": {"pos": "motion.pos"},
+    "defaults": {"extra": 7, "motion.state": 1},
+    "reverseDefaults": {"old_name": 99}
+  },
+  {"message": "Info", "rename": {"a": "a2"}},
+  {"message": "HpNotify", "wrap": {"hp": "value"}}
+]`
+
+func TestFieldRules(t *testing.T) {
+	m, err := newRulesTestMapping(t, testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		from, to Protocol
+		message  string
+		in, want string
+	}{
+		{
+			name: "rename and move", from: "v1", to: "v2", message: "EntityNotify",
+			in:   `{"entityId":1,"pos":{"x":1},"oldName":5}`,
+			want: `{"entityId":1,"motion":{"pos":{"x":1},"state":1},"newName":5,"extra":7}`,
+		},
+		{
+			name: "nested rename", from: "v1", to: "v2", message: "EntityNotify",
+			in:   `{"infos":[{"a":1,"b":2},{"a":3}],"infoMap":{"4":{"a":9}}}`,
+			want: `{"infos":[{"a2":1,"b":2},{"a2":3}],"infoMap":{"4":{"a2":9}},"motion":{"state":1},"extra":7}`,
+		},
+		{
+			name: "defaults do not override", from: "v1", to: "v2", message: "EntityNotify",
+			in:   `{"pos":{"x":1}}`,
+			want: `{"motion":{"pos":{"x":1},"state":1},"extra":7}`,
+		},
+		{
+			name: "reverse rename and move", from: "v2", to: "v1", message: "EntityNotify",
+			in:   `{"entityId":1,"motion":{"pos":{"x":1},"state":3},"newName":5,"extra":2,"infos":[{"a2":4}]}`,
+			want: `{"entityId":1,"pos":{"x":1},"oldName":5,"infos":[{"a":4}]}`,
+		},
+		{
+			name: "reverse defaults", from: "v2", to: "v1", message: "EntityNotify",
+			in:   `{"entityId":1}`,
+			want: `{"entityId":1,"oldName":99}`,
+		},
+		{
+			name: "wrap", from: "v1", to: "v2", message: "HpNotify",
+			in:   `{"hp":10}`,
+			want: `{"hp":{"value":10}}`,
+		},
+		{
+			name: "unwrap", from: "v2", to: "v1", message: "HpNotify",
+			in:   `{"hp":{"value":10}}`,
+			want: `{"hp":10}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkConverted(t, m, tt.from, tt.to, tt.message, tt.in, tt.want)
+		})
+	}
+}
+
+func TestFieldRulesInvalid(t *testing.T) {
+	tests := []struct {
+		name, rules, err string
+	}{
+		{"no message", `[{"rename": {"a": "b"}}]`, "rule without message or enum name"},
+		{"not a list", `{"message": "EntityNotify"}`, "failed to parse rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newRulesTestMapping(t, tt.rules)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package mapper
+
+import (
+	"math"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// SchemaEqual reports whether the message has the same schema in both
+// protocols, including every message and enum it depends on, so that its
+// payload can be forwarded without conversion.
+func (m *Mapping) SchemaEqual(from, to Protocol, name string) bool {
+	if from == to {
+		return true
+	}
+	return m.SchemaEqualMap[from][to][name]
+}
+
+func (m *Mapping) loadSchemaEquality() {
+	m.messageEqual = make(map[[2]*desc.MessageDescriptor]bool)
+	for from, fromDescs := range m.MessageDescMap {
+		for to, toDescs := range m.MessageDescMap {
+			if from >= to {
+				continue
+			}
+			c := &schemaComparer{
+				rules:   [2]map[string]*MessageRules{m.MessageRulesMap[from][to], m.MessageRulesMap[to][from]},
+				aliases: [2]map[string]string{m.MessageAliasMap[from], m.MessageAliasMap[to]},
+				enums:   [2]map[string]EnumRules{m.EnumRulesMap[from][to], m.EnumRulesMap[to][from]},
+				ids:     [2]*IDFields{m.IDFieldsMap[from][to], m.IDFieldsMap[to][from]},
+				seen:    make(map[[2]*desc.MessageDescriptor]bool),
+				assumed: make(map[[2]*desc.MessageDescriptor]int),
+				low:     math.MaxInt,
+
+				descs:    [2]map[string]*desc.MessageDescriptor{fromDescs, toDescs},
+				embedded: [2]map[string][]*EmbeddedField{m.EmbeddedFieldMap[from], m.EmbeddedFieldMap[to]},
+			}
+			equal := make(map[string]bool)
+			for name, fromDesc := range fromDescs {
+				toDesc := toDescs[name]
+				if fromDesc == nil || toDesc == nil {
+					continue
+				}
+				if c.message(fromDesc, toDesc) {
+					equal[name] = true
+				}
+			}
+			if m.SchemaEqualMap[from] == nil {
+				m.SchemaEqualMap[from] = make(map[Protocol]map[string]bool)
+			}
+			if m.SchemaEqualMap[to] == nil {
+				m.SchemaEqualMap[to] = make(map[Protocol]map[string]bool)
+			}
+			m.SchemaEqualMap[from][to] = equal
+			m.SchemaEqualMap[to][from] = equal
+			for key, equal := range c.seen {
+				if equal {
+					m.messageEqual[key] = true
+					m.messageEqual[[2]*desc.MessageDescriptor{key[1], key[0]}] = true
+				}
+			}
+		}
+	}
+}
+
+type schemaComparer struct {
+	rules   [2]map[string]*MessageRules
+	aliases [2]map[string]string
+	enums   [2]map[string]EnumRules
+	ids     [2]*IDFields
+	seen    map[[2]*desc.MessageDescriptor]bool
+
+	// assumed are the messages being compared, by depth, and those found
+	// equal while relying on one of them, pending in order, by the lowest
+	// depth they rely on.
+	assumed map[[2]*desc.MessageDescriptor]int
+	pending [][2]*desc.MessageDescriptor
+	depth   int
+	low     int
+
+	descs    [2]map[string]*desc.MessageDescriptor
+	embedded [2]map[string][]*EmbeddedField
+}
+
+// hasRules tells if the rules of either direction reshape the message of
+// either side, by its canonical name.
+func (c *schemaComparer) hasRules(a, b *desc.MessageDescriptor) bool {
+	for i, md := range [2]*desc.MessageDescriptor{a, b} {
+		name := md.GetName()
+		if canonical, ok := c.aliases[i][name]; ok {
+			name = canonical
+		}
+		if c.rules[0][name] != nil || c.rules[1][name] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// message compares the messages, assuming the messages being compared are
+// equal until proven otherwise. The messages found equal while relying on
+// such an assumption are kept pending until the message assumed equal is,
+// and discarded if it is not.
+func (c *schemaComparer) message(a, b *desc.MessageDescriptor) bool {
+	key := [2]*desc.MessageDescriptor{a, b}
+	if equal, ok := c.seen[key]; ok {
+		return equal
+	}
+	if low, ok := c.assumed[key]; ok {
+		if low < c.low {
+			c.low = low
+		}
+		return true
+	}
+	depth := c.depth
+	c.assumed[key] = depth
+	c.depth++
+	outer, mark := c.low, len(c.pending)
+	c.low = math.MaxInt
+	equal := c.compareMessage(a, b)
+	c.depth--
+	low := c.low
+	switch {
+	case !equal:
+		for _, k := range c.pending[mark:] {
+			delete(c.assumed, k)
+		}
+		c.pending = c.pending[:mark]
+		delete(c.assumed, key)
+		c.seen[key] = false
+		low = math.MaxInt
+	case low >= depth:
+		// Nothing being compared outside of the message was assumed.
+		for _, k := range c.pending[mark:] {
+			delete(c.assumed, k)
+			c.seen[k] = true
+		}
+		c.pending = c.pending[:mark]
+		delete(c.assumed, key)
+		c.seen[key] = true
+		low = math.MaxInt
+	default:
+		c.assumed[key] = low
+		c.pending = append(c.pending, key)
+	}
+	if low < outer {
+		outer = low
+	}
+	c.low = outer
+	return equal
+}
+
+func (c *schemaComparer) compareMessage(a, b *desc.MessageDescriptor) bool {
+	if c.hasRules(a, b) {
+		return false
+	}
+	// The ids are remapped field by field during the conversion.
+	if c.ids[0].has(a) || c.ids[1].has(b) {
+		return false
+	}
+	// The payloads chosen through a table may be of any message, those of a
+	// fixed message are compared as a field of that message.
+	fa, fb := c.embedded[0][a.GetName()], c.embedded[1][b.GetName()]
+	if len(fa) != len(fb) {
+		return false
+	}
+	for _, ea := range fa {
+		eb := findEmbeddedField(fb, ea.Field)
+		if eb == nil || ea.Type != "" || eb.Type != "" || ea.Payload != eb.Payload {
+			return false
+		}
+		pa, pb := c.descs[0][ea.Payload], c.descs[1][eb.Payload]
+		if pa == nil || pb == nil || !c.message(pa, pb) {
+			return false
+		}
+	}
+	if len(a.GetFields()) != len(b.GetFields()) {
+		return false
+	}
+	for _, fa := range a.GetFields() {
+		fb := b.FindFieldByNumber(fa.GetNumber())
+		if fb == nil || !c.field(fa, fb) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *schemaComparer) field(a, b *desc.FieldDescriptor) bool {
+	if a.GetName() != b.GetName() || a.GetType() != b.GetType() || a.GetLabel() != b.GetLabel() || a.IsMap() != b.IsMap() {
+		return false
+	}
+	if ma, mb := a.GetMessageType(), b.GetMessageType(); ma != nil && mb != nil {
+		return c.message(ma, mb)
+	}
+	if ea, eb := a.GetEnumType(), b.GetEnumType(); ea != nil && eb != nil {
+		return c.enum(ea, eb)
+	}
+	return true
+}
+
+func (c *schemaComparer) enum(a, b *desc.EnumDescriptor) bool {
+	for _, enums := range c.enums {
+		if enums[a.GetName()] != nil || enums[b.GetName()] != nil {
+			return false
+		}
+	}
+	if len(a.GetValues()) != len(b.GetValues()) {
+		return false
+	}
+	for _, va := range a.GetValues() {
+		vb := b.FindValueByName(va.GetName())
+		if vb == nil || va.GetNumber() != vb.GetNumber() {
+			return false
+		}
+	}
+	return true
+}
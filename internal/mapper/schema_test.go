@@ -0,0 +1,106 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+func TestSchemaEqualRecursive(t *testing.T) {
+	tests := []struct {
+		name   string
+		v1, v2 string
+		equal  []string // the messages of the same schema
+	}{
+		{
+			"nested message changed, visited first",
+			`message Root { B b = 1; A a = 2; }
+message A { B b = 1; uint32 x = 2; }
+message B { A a = 1; uint32 y = 2; }`,
+			`message Root { B b = 1; A a = 2; }
+message A { B b = 1; uint32 x = 2; }
+message B { A a = 1; string y = 2; }`,
+			nil,
+		},
+		{
+			"nested message changed, visited last",
+			`message Root { A a = 1; B b = 2; }
+message A { B b = 1; uint32 x = 2; }
+message B { A a = 1; uint32 y = 2; }`,
+			`message Root { A a = 1; B b = 2; }
+message A { B b = 1; uint32 x = 2; }
+message B { A a = 1; string y = 2; }`,
+			nil,
+		},
+		{
+			"cycle of three",
+			`message Root { C c = 1; B b = 2; A a = 3; }
+message A { B b = 1; }
+message B { C c = 1; }
+message C { A a = 1; uint32 y = 2; }`,
+			`message Root { C c = 1; B b = 2; A a = 3; }
+message A { B b = 1; }
+message B { C c = 1; }
+message C { A a = 1; int64 y = 2; }`,
+			nil,
+		},
+		{
+			"unchanged cycle",
+			`message Root { B b = 1; A a = 2; }
+message A { B b = 1; uint32 x = 2; }
+message B { A a = 1; repeated A list = 2; }`,
+			`message Root { B b = 1; A a = 2; }
+message A { B b = 1; uint32 x = 2; }
+message B { A a = 1; repeated A list = 2; }`,
+			[]string{"Root", "A", "B"},
+		},
+		{
+			"message outside the cycle",
+			`message Root { B b = 1; D d = 2; A a = 3; }
+message A { B b = 1; D d = 2; }
+message B { A a = 1; uint32 y = 2; }
+message D { uint32 z = 1; }`,
+			`message Root { B b = 1; D d = 2; A a = 3; }
+message A { B b = 1; D d = 2; }
+message B { A a = 1; sint32 y = 2; }
+message D { uint32 z = 1; }`,
+			[]string{"D"},
+		},
+		{
+			"self recursive",
+			`message Root { Tree tree = 1; Leaf leaf = 2; }
+message Tree { repeated Tree children = 1; Leaf leaf = 2; }
+message Leaf { uint32 v = 1; }`,
+			`message Root { Tree tree = 1; Leaf leaf = 2; }
+message Tree { repeated Tree children = 1; Leaf leaf = 2; }
+message Leaf { uint32 v = 1; }`,
+			[]string{"Root", "Tree", "Leaf"},
+		},
+	}
+	protocol := func(messages string) map[string]string {
+		return map[string]string{
+			"protocol.csv":        "Root,1\n",
+			"arguments.json":      `{"ability": [], "combat": []}`,
+			"protocol/Root.proto": "syntax = \"proto3\";\n" + messages,
+		}
+	}
+	for _, tt := range tests {
+		m := newTestMapping(t, "v1", map[Protocol]map[string]string{"v1": protocol(tt.v1), "v2": protocol(tt.v2)})
+		equal := make(map[string]bool)
+		for _, name := range tt.equal {
+			equal[name] = true
+		}
+		if got := m.SchemaEqual("v1", "v2", "Root"); got != equal["Root"] {
+			t.Errorf("%s: SchemaEqual(Root) = %t, want %t", tt.name, got, equal["Root"])
+		}
+		f1, f2 := m.MessageDescMap["v1"]["Root"].GetFile(), m.MessageDescMap["v2"]["Root"].GetFile()
+		for _, md := range f1.GetMessageTypes() {
+			name := md.GetName()
+			for _, key := range [][2]*desc.MessageDescriptor{{md, f2.FindMessage(name)}, {f2.FindMessage(name), md}} {
+				if got := m.messageEqual[key]; got != equal[name] {
+					t.Errorf("%s: %s equal %t, want %t", tt.name, name, got, equal[name])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package mapper
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing/fstest"
+
+	"github.com/Jx2f/ViaGenshin/data"
+	"github.com/Jx2f/ViaGenshin/internal/config"
+)
+
+// bundleFile is the descriptor bundle replacing the protocol folder, a
+// FileDescriptorSet of the compiled proto files.
+const bundleFile = "protocol.pb"
+
+// protocolSource holds the files of data/mapping/{{ VERSION }}, read from a
+// directory, a zip or tar.gz archive, a descriptor bundle or the protocols
+// embedded in the binary.
+type protocolSource struct {
+	fs.FS
+	// name is the location of the protocol, as configured.
+	name string
+	// dir is the directory on disk, where the descriptor cache is written,
+	// empty if the protocol is not read from a directory.
+	dir string
+}
+
+// path returns the location of the file, for the messages.
+func (s *protocolSource) path(file string) string {
+	return path.Join(filepath.ToSlash(s.name), file)
+}
+
+// SourceDigest hashes the protocols config and the files of the protocols,
+// the descriptor caches aside, to tell if the mapping would load the same.
+func SourceDigest(c *config.ConfigProtocols) (string, error) {
+	h := sha256.New()
+	conf, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	writeHashed(h, conf)
+	versions := make([]Protocol, 0, len(c.Mapping))
+	for v := range c.Mapping {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for _, v := range versions {
+		src, err := openProtocol(c.Mapping[v])
+		if err != nil {
+			return "", fmt.Errorf("failed to open protocol %s: %w", v, err)
+		}
+		err = fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if name == ".cache" {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			content, err := fs.ReadFile(src, name)
+			if err != nil {
+				return err
+			}
+			writeHashed(h, []byte(name))
+			writeHashed(h, content)
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to read protocol %s: %w", v, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openProtocol opens the location of a protocol, embed:{{ NAME }} names a
+// protocol of data/embed in a binary built with -tags embed.
+func openProtocol(location string) (*protocolSource, error) {
+	if name, ok := strings.CutPrefix(location, "embed:"); ok {
+		if data.Protocols == nil {
+			return nil, fmt.Errorf("no embedded protocols for %s, build with -tags embed", location)
+		}
+		fsys, err := openSource(data.Protocols, name)
+		if err != nil {
+			return nil, err
+		}
+		return &protocolSource{FS: fsys, name: location}, nil
+	}
+	if info, err := os.Stat(location); err == nil && info.IsDir() {
+		return &protocolSource{FS: os.DirFS(location), name: location, dir: location}, nil
+	}
+	fsys, err := openSource(os.DirFS(filepath.Dir(location)), filepath.Base(location))
+	if err != nil {
+		return nil, err
+	}
+	return &protocolSource{FS: fsys, name: location}, nil
+}
+
+func openSource(parent fs.FS, name string) (fs.FS, error) {
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		b, err := fs.ReadFile(parent, name)
+		if err != nil {
+			return nil, err
+		}
+		r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		return archiveRoot(r)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		b, err := fs.ReadFile(parent, name)
+		if err != nil {
+			return nil, err
+		}
+		files, err := readTarGz(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		return archiveRoot(files)
+	case strings.HasSuffix(name, ".pb"):
+		b, err := fs.ReadFile(parent, name)
+		if err != nil {
+			return nil, err
+		}
+		return fstest.MapFS{bundleFile: {Data: b, Mode: 0o644}}, nil
+	}
+	return fs.Sub(parent, name)
+}
+
+// archiveRoot steps into the single folder of an archive, as archives are
+// often made of the protocol folder itself.
+func archiveRoot(fsys fs.FS) (fs.FS, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return fs.Sub(fsys, entries[0].Name())
+	}
+	return fsys, nil
+}
+
+// readTarGz reads the regular files of the archive in memory, the folders
+// are those of the file paths.
+func readTarGz(b []byte) (fstest.MapFS, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	files := make(fstest.MapFS)
+	r := tar.NewReader(gz)
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(h.Name, "/"))
+		if !fs.ValidPath(name) {
+			return nil, fmt.Errorf("invalid file name %s", h.Name)
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = &fstest.MapFile{Data: content, Mode: 0o644}
+	}
+}
@@ -0,0 +1,184 @@
+package mapper
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Jx2f/ViaGenshin/data"
+	"github.com/Jx2f/ViaGenshin/internal/config"
+)
+
+func zipTestFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	b := new(bytes.Buffer)
+	w := zip.NewWriter(b)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func tarGzTestFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	b := new(bytes.Buffer)
+	gz := gzip.NewWriter(b)
+	w := tar.NewWriter(gz)
+	for name, content := range files {
+		h := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, "/") {
+			h.Typeflag, h.Size = tar.TypeDir, 0
+		}
+		if err := w.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestOpenProtocol(t *testing.T) {
+	dir := t.TempDir()
+	protocol := map[string]string{
+		"protocol.csv":            "PingReq,1\n",
+		"protocol/PingReq.proto":  "syntax = \"proto3\";\nmessage PingReq { uint32 seq = 1; }",
+		"protocol/nested/a.proto": "nested",
+		"aliases.json":            "{}",
+	}
+	inFolder := func(folder string) map[string]string {
+		files := make(map[string]string)
+		for name, content := range protocol {
+			files[folder+name] = content
+		}
+		return files
+	}
+	writeTestFiles(t, filepath.Join(dir, "folder"), protocol)
+	archives := map[string][]byte{
+		"flat.zip":    zipTestFiles(t, protocol),
+		"folder.zip":  zipTestFiles(t, inFolder("3.2.0/")),
+		"two.zip":     zipTestFiles(t, map[string]string{"a/protocol.csv": "", "b/protocol.csv": ""}),
+		"flat.tar.gz": tarGzTestFiles(t, protocol),
+		"folder.tgz":  tarGzTestFiles(t, inFolder("3.2.0/")),
+		"dirs.tgz":    tarGzTestFiles(t, map[string]string{"3.2.0/": "", "3.2.0/protocol.csv": "PingReq,1\n"}),
+		"abs.tgz":     tarGzTestFiles(t, map[string]string{"/protocol.csv": "PingReq,1\n"}),
+		"unsafe.tgz":  tarGzTestFiles(t, map[string]string{"../protocol.csv": "PingReq,1\n"}),
+		"protocol.pb": []byte("bundle"),
+		"broken.zip":  []byte("not a zip"),
+		"broken.tgz":  []byte("not a tar.gz"),
+	}
+	for name, b := range archives {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(p fs.FS) { data.Protocols = p }(data.Protocols)
+	data.Protocols = fstest.MapFS{
+		"3.2.0/protocol.csv": {Data: []byte("PingReq,1\n")},
+		"3.3.0.zip":          {Data: zipTestFiles(t, inFolder("3.3.0/"))},
+	}
+
+	tests := []struct {
+		location string
+		file     string // a file of the protocol
+		content  string
+		dir      bool
+	}{
+		{"folder", "protocol.csv", "PingReq,1\n", true},
+		{"flat.zip", "protocol/nested/a.proto", "nested", false},
+		{"folder.zip", "protocol.csv", "PingReq,1\n", false},
+		{"two.zip", "a/protocol.csv", "", false},
+		{"flat.tar.gz", "protocol/nested/a.proto", "nested", false},
+		{"folder.tgz", "protocol/PingReq.proto", protocol["protocol/PingReq.proto"], false},
+		{"dirs.tgz", "protocol.csv", "PingReq,1\n", false},
+		{"abs.tgz", "protocol.csv", "PingReq,1\n", false},
+		{"protocol.pb", bundleFile, "bundle", false},
+		{"embed:3.2.0", "protocol.csv", "PingReq,1\n", false},
+		{"embed:3.3.0.zip", "aliases.json", "{}", false},
+	}
+	for _, tt := range tests {
+		location := tt.location
+		if !strings.HasPrefix(location, "embed:") {
+			location = filepath.Join(dir, location)
+		}
+		src, err := openProtocol(location)
+		if err != nil {
+			t.Errorf("%s: %v", tt.location, err)
+			continue
+		}
+		content, err := fs.ReadFile(src, tt.file)
+		if err != nil || string(content) != tt.content {
+			t.Errorf("%s: %s = %q, %v, want %q", tt.location, tt.file, content, err, tt.content)
+		}
+		if (src.dir != "") != tt.dir {
+			t.Errorf("%s: dir %q, want a dir %t", tt.location, src.dir, tt.dir)
+		}
+	}
+
+	for _, location := range []string{"unsafe.tgz", "broken.zip", "broken.tgz", "missing.zip"} {
+		if _, err := openProtocol(filepath.Join(dir, location)); err == nil {
+			t.Errorf("%s: opened", location)
+		}
+	}
+	if _, err := openProtocol("embed:missing.zip"); err == nil {
+		t.Error("embed:missing.zip: opened")
+	}
+	data.Protocols = nil
+	if _, err := openProtocol("embed:3.2.0"); err == nil || !strings.Contains(err.Error(), "-tags embed") {
+		t.Errorf("embed:3.2.0 without embedded protocols: %v", err)
+	}
+}
+
+func TestMappingFromArchive(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"3.2.0/protocol.csv":           "PingReq,1\n",
+		"3.2.0/arguments.json":         `{"ability": [], "combat": []}`,
+		"3.2.0/protocol/PingReq.proto": "syntax = \"proto3\";\nmessage PingReq { uint32 seq = 1; }",
+	}
+	if err := os.WriteFile(filepath.Join(dir, "3.2.0.tgz"), tarGzTestFiles(t, files), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, filepath.Join(dir, "3.3.0"), map[string]string{
+		"protocol.csv":           "PingReq,2\n",
+		"arguments.json":         `{"ability": [], "combat": []}`,
+		"protocol/PingReq.proto": "syntax = \"proto3\";\nmessage PingReq { uint32 seq = 1; }",
+	})
+	m, err := NewMappingFromConfig(&config.ConfigProtocols{
+		BaseProtocol: "3.2.0",
+		Mapping:      map[Protocol]string{"3.2.0": filepath.Join(dir, "3.2.0.tgz"), "3.3.0": filepath.Join(dir, "3.3.0")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := m.CommandPairMap["3.2.0"]["3.3.0"][1]; id != 2 {
+		t.Errorf("command 1 paired with %d, want 2", id)
+	}
+	// Only the folders are cached.
+	if _, err := os.Stat(filepath.Join(dir, "3.3.0", ".cache")); err != nil {
+		t.Errorf("no cache of the folder: %v", err)
+	}
+}
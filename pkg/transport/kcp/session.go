@@ -125,6 +125,7 @@ func (s *Session) closeSession(reason DisconnectReason) error {
 		unmanaged.conns.Lock()
 		delete(unmanaged.conns.conns, s.sessionID)
 		unmanaged.conns.Unlock()
+		s.ctxCancel()
 		return s.conn.Close()
 	}
 	s.ctxCancel()